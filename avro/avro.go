@@ -0,0 +1,213 @@
+// Copyright (c) 2017 Josh Rickmar
+// Use of this source code is governed by an ISC
+// license that can be found in the LICENSE file.
+
+// Package avro implements a mill codec which encodes log entries as Avro binary
+// datums.
+//
+// Entries are encoded as records described by a schema provided by the
+// application (typically registered with a schema registry).  The schema must
+// be a record whose fields are a subset of the following, with matching types:
+//
+//	timestamp  "long", with an optional logicalType of "timestamp-millis" or
+//	           "timestamp-micros" (otherwise nanoseconds since the Unix epoch)
+//	tags       {"type": "array", "items": "string"}
+//	message    "string"
+//	data       {"type": "map", "values": "string"}
+//
+// Fields are encoded in the order of the schema.  Tag pairs are encoded as
+// key=value, and data values are encoded using their default string
+// formatting, or the string null for absent values (see mill.Null).
+//
+// Each entry is written as a single bare datum without any framing, such as
+// the Avro object container format or a schema registry header.
+package avro
+
+import (
+	"encoding/binary"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"time"
+
+	"github.com/jrick/mill"
+)
+
+type fieldKind int
+
+const (
+	fieldTimestampNanos fieldKind = iota
+	fieldTimestampMicros
+	fieldTimestampMillis
+	fieldTags
+	fieldMessage
+	fieldData
+)
+
+type codec struct {
+	writer io.Writer
+	fields []fieldKind
+}
+
+type schemaField struct {
+	Name string          `json:"name"`
+	Type json.RawMessage `json:"type"`
+}
+
+type schemaRecord struct {
+	Type   string        `json:"type"`
+	Name   string        `json:"name"`
+	Fields []schemaField `json:"fields"`
+}
+
+type complexType struct {
+	Type        string `json:"type"`
+	Items       string `json:"items"`
+	Values      string `json:"values"`
+	LogicalType string `json:"logicalType"`
+}
+
+// parseType parses a field type, which may be a primitive type name or a
+// complex type object.
+func parseType(raw json.RawMessage) (complexType, error) {
+	var t complexType
+	var name string
+	if err := json.Unmarshal(raw, &name); err == nil {
+		t.Type = name
+		return t, nil
+	}
+	err := json.Unmarshal(raw, &t)
+	return t, err
+}
+
+// AvroCodec creates a mill.Codec which encodes log entries as Avro binary datums
+// described by schema and writes them to w.  An error is returned if the
+// schema is not a record schema compatible with log entries.
+func AvroCodec(w io.Writer, schema string) (mill.Codec, error) {
+	var rec schemaRecord
+	if err := json.Unmarshal([]byte(schema), &rec); err != nil {
+		return nil, fmt.Errorf("avro: invalid schema: %v", err)
+	}
+	if rec.Type != "record" {
+		return nil, errors.New("avro: schema is not a record")
+	}
+
+	c := &codec{writer: w}
+	seen := make(map[string]bool)
+	for _, f := range rec.Fields {
+		if seen[f.Name] {
+			return nil, fmt.Errorf("avro: duplicate field %q", f.Name)
+		}
+		seen[f.Name] = true
+		t, err := parseType(f.Type)
+		if err != nil {
+			return nil, fmt.Errorf("avro: invalid type of field %q: %v", f.Name, err)
+		}
+		var kind fieldKind
+		var ok bool
+		switch f.Name {
+		case "timestamp":
+			ok = t.Type == "long"
+			switch t.LogicalType {
+			case "":
+				kind = fieldTimestampNanos
+			case "timestamp-micros":
+				kind = fieldTimestampMicros
+			case "timestamp-millis":
+				kind = fieldTimestampMillis
+			default:
+				ok = false
+			}
+		case "tags":
+			kind, ok = fieldTags, t.Type == "array" && t.Items == "string"
+		case "message":
+			kind, ok = fieldMessage, t.Type == "string"
+		case "data":
+			kind, ok = fieldData, t.Type == "map" && t.Values == "string"
+		default:
+			return nil, fmt.Errorf("avro: unsupported field %q", f.Name)
+		}
+		if !ok {
+			return nil, fmt.Errorf("avro: incompatible type of field %q", f.Name)
+		}
+		c.fields = append(c.fields, kind)
+	}
+	return c, nil
+}
+
+func appendLong(b []byte, v int64) []byte {
+	var buf [binary.MaxVarintLen64]byte
+	n := binary.PutVarint(buf[:], v) // zig-zag encoded
+	return append(b, buf[:n]...)
+}
+
+func appendString(b []byte, s string) []byte {
+	b = appendLong(b, int64(len(s)))
+	return append(b, s...)
+}
+
+func hasDebugTag(tags []mill.KV) bool {
+	for _, tag := range tags {
+		if tag.Key == "debug" && tag.Value == "" {
+			return true
+		}
+	}
+	return false
+}
+
+func (c *codec) EncodeLogEntry(t time.Time, tags []mill.KV, message string, data []mill.Data, encodeDone func(), writeReady <-chan struct{}) {
+	var b []byte
+	for _, kind := range c.fields {
+		switch kind {
+		case fieldTimestampNanos:
+			b = appendLong(b, t.UnixNano())
+		case fieldTimestampMicros:
+			b = appendLong(b, t.UnixNano()/int64(time.Microsecond))
+		case fieldTimestampMillis:
+			b = appendLong(b, t.UnixNano()/int64(time.Millisecond))
+		case fieldTags:
+			if len(tags) != 0 {
+				b = appendLong(b, int64(len(tags)))
+				for _, tag := range tags {
+					s := tag.Key
+					if tag.Value != "" {
+						s += "=" + tag.Value
+					}
+					b = appendString(b, s)
+				}
+			}
+			b = appendLong(b, 0)
+		case fieldMessage:
+			b = appendString(b, message)
+		case fieldData:
+			debug := hasDebugTag(tags)
+			var n int64
+			for i := range data {
+				if !data[i].IsDebugOnly() || debug {
+					n++
+				}
+			}
+			if n != 0 {
+				b = appendLong(b, n)
+				for i := range data {
+					d := &data[i]
+					if d.IsDebugOnly() && !debug {
+						continue
+					}
+					b = appendString(b, d.Name())
+					if d.IsNull() {
+						b = appendString(b, "null")
+					} else {
+						b = appendString(b, fmt.Sprint(d.Value()))
+					}
+				}
+			}
+			b = appendLong(b, 0)
+		}
+	}
+	encodeDone()
+
+	<-writeReady
+	c.writer.Write(b)
+}
@@ -0,0 +1,127 @@
+// Copyright (c) 2017 Josh Rickmar
+// Use of this source code is governed by an ISC
+// license that can be found in the LICENSE file.
+
+package avro
+
+import (
+	"bytes"
+	"context"
+	"encoding/binary"
+	"reflect"
+	"testing"
+	"time"
+
+	"github.com/jrick/mill"
+)
+
+const testSchema = `{
+	"type": "record",
+	"name": "LogEntry",
+	"fields": [
+		{"name": "timestamp", "type": {"type": "long", "logicalType": "timestamp-micros"}},
+		{"name": "tags", "type": {"type": "array", "items": "string"}},
+		{"name": "message", "type": "string"},
+		{"name": "data", "type": {"type": "map", "values": "string"}}
+	]
+}`
+
+type decoder struct {
+	r *bytes.Reader
+	t *testing.T
+}
+
+func (d *decoder) long() int64 {
+	v, err := binary.ReadVarint(d.r)
+	if err != nil {
+		d.t.Fatal(err)
+	}
+	return v
+}
+
+func (d *decoder) string() string {
+	b := make([]byte, d.long())
+	if _, err := d.r.Read(b); err != nil && len(b) != 0 {
+		d.t.Fatal(err)
+	}
+	return string(b)
+}
+
+// blocks decodes the blocks of an array or map, calling item for each item.
+func (d *decoder) blocks(item func()) {
+	for {
+		n := d.long()
+		if n == 0 {
+			return
+		}
+		if n < 0 {
+			n = -n
+			d.long() // block size in bytes
+		}
+		for ; n > 0; n-- {
+			item()
+		}
+	}
+}
+
+func TestCodec(t *testing.T) {
+	var buf bytes.Buffer
+	c, err := AvroCodec(&buf, testSchema)
+	if err != nil {
+		t.Fatal(err)
+	}
+	ctx := mill.WithLogger(mill.WithLogTagPair(context.Background(), "request", "1"), c)
+	mill.Log(ctx, "hello", mill.Int64("n", -3), mill.Duration("elapsed", time.Second),
+		mill.DebugOnly("hidden", 1))
+	mill.Log(mill.WithLogger(context.Background(), c), "bare")
+	mill.Sync()
+
+	d := &decoder{r: bytes.NewReader(buf.Bytes()), t: t}
+	type entry struct {
+		tags    []string
+		message string
+		data    map[string]string
+	}
+	want := []entry{
+		{[]string{"request=1"}, "hello", map[string]string{"n": "-3", "elapsed": "1s"}},
+		{nil, "bare", map[string]string{}},
+	}
+	now := time.Now().UnixNano() / int64(time.Microsecond)
+	for i, w := range want {
+		ts := d.long()
+		if ts <= 0 || ts > now {
+			t.Errorf("entry %d: bad timestamp %d", i, ts)
+		}
+		var e entry
+		d.blocks(func() { e.tags = append(e.tags, d.string()) })
+		e.message = d.string()
+		e.data = make(map[string]string)
+		d.blocks(func() {
+			k := d.string()
+			e.data[k] = d.string()
+		})
+		if !reflect.DeepEqual(e, w) {
+			t.Errorf("entry %d: decoded %+v, want %+v", i, e, w)
+		}
+	}
+	if d.r.Len() != 0 {
+		t.Errorf("%d trailing bytes", d.r.Len())
+	}
+}
+
+func TestCodecSchemaErrors(t *testing.T) {
+	tests := []string{
+		`not json`,
+		`{"type": "enum", "name": "E", "symbols": ["A"]}`,
+		`{"type": "record", "name": "R", "fields": [{"name": "message", "type": "long"}]}`,
+		`{"type": "record", "name": "R", "fields": [{"name": "level", "type": "string"}]}`,
+		`{"type": "record", "name": "R", "fields": [{"name": "data", "type": {"type": "map", "values": "long"}}]}`,
+		`{"type": "record", "name": "R", "fields": [{"name": "timestamp", "type": {"type": "long", "logicalType": "date"}}]}`,
+		`{"type": "record", "name": "R", "fields": [{"name": "message", "type": "string"}, {"name": "message", "type": "string"}]}`,
+	}
+	for _, schema := range tests {
+		if _, err := AvroCodec(nil, schema); err == nil {
+			t.Errorf("no error for schema %s", schema)
+		}
+	}
+}
@@ -0,0 +1,102 @@
+// Copyright (c) 2017 Josh Rickmar
+// Use of this source code is governed by an ISC
+// license that can be found in the LICENSE file.
+
+package mill
+
+import (
+	"sync"
+	"time"
+)
+
+// DefaultBackoffQuietPeriod is the quiet period used by BackoffDedupCodec when
+// none is provided.
+const DefaultBackoffQuietPeriod = time.Minute
+
+// MaxBackoffMessages is the maximum number of distinct messages for which
+// BackoffDedupCodec records occurrences.
+const MaxBackoffMessages = 10000
+
+type backoffState struct {
+	count uint64
+	last  time.Time
+}
+
+type backoffDedupCodec struct {
+	inner  Codec
+	quiet  time.Duration
+	states map[string]*backoffState
+	mu     sync.Mutex
+}
+
+// BackoffDedupCodec creates a Codec that throttles repeated log entries with
+// exponential backoff.  Only the 1st, 2nd, 4th, 8th, ... occurrence of each
+// message is encoded with the inner codec, so a repeatedly failing operation
+// remains visible without flooding the log.  Encoded repeats include an
+// "occurrences" field with the number of occurrences so far.
+//
+// The occurrences of a message are counted from zero again once the message
+// has not been logged for the quiet period.  A zero quiet period uses
+// DefaultBackoffQuietPeriod.  Occurrences are recorded for at most
+// MaxBackoffMessages messages.  When a new message is logged with no room
+// left, the messages that have been quiet are forgotten, or if there are
+// none, an arbitrary message is forgotten and its occurrences are counted from
+// zero again.
+func BackoffDedupCodec(inner Codec, quiet time.Duration) Codec {
+	if quiet <= 0 {
+		quiet = DefaultBackoffQuietPeriod
+	}
+	return &backoffDedupCodec{
+		inner:  inner,
+		quiet:  quiet,
+		states: make(map[string]*backoffState),
+	}
+}
+
+// occurrence records an occurrence of message logged at t, returning the
+// number of occurrences in the current period.
+func (c *backoffDedupCodec) occurrence(message string, t time.Time) uint64 {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	s := c.states[message]
+	if s == nil {
+		if len(c.states) >= MaxBackoffMessages {
+			c.evict(t)
+		}
+		s = new(backoffState)
+		c.states[message] = s
+	} else if t.Sub(s.last) >= c.quiet {
+		s.count = 0
+	}
+	s.count++
+	s.last = t
+	return s.count
+}
+
+// evict removes the states of all messages that have been quiet at t, or an
+// arbitrary state if none have.  It must be called with c.mu held.
+func (c *backoffDedupCodec) evict(t time.Time) {
+	var any string
+	for message, s := range c.states {
+		if t.Sub(s.last) >= c.quiet {
+			delete(c.states, message)
+		}
+		any = message
+	}
+	if len(c.states) >= MaxBackoffMessages {
+		delete(c.states, any)
+	}
+}
+
+func (c *backoffDedupCodec) EncodeLogEntry(t time.Time, tags []KV, message string, data []Data, encodeDone func(), writeReady <-chan struct{}) {
+	n := c.occurrence(message, t)
+	if n&(n-1) != 0 {
+		// Not a power of two.
+		dropEntry(encodeDone, writeReady)
+		return
+	}
+	if n > 1 {
+		data = append(data[:len(data):len(data)], Uint64("occurrences", n))
+	}
+	c.inner.EncodeLogEntry(t, tags, message, data, encodeDone, writeReady)
+}
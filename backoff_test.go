@@ -0,0 +1,79 @@
+// Copyright (c) 2017 Josh Rickmar
+// Use of this source code is governed by an ISC
+// license that can be found in the LICENSE file.
+
+package mill
+
+import (
+	"context"
+	"errors"
+	"strconv"
+	"testing"
+	"time"
+)
+
+func TestBackoffDedupCodec(t *testing.T) {
+	const quiet = 50 * time.Millisecond
+	c := &recordingCodec{}
+	ctx := WithLogger(context.Background(), BackoffDedupCodec(c, quiet))
+	err := errors.New("connection refused")
+	for i := 1; i <= 20; i++ {
+		Log(ctx, "dial failed", Error(err), Int64("i", int64(i)))
+	}
+	Log(ctx, "other")
+	time.Sleep(2 * quiet)
+	Log(ctx, "dial failed", Error(err), Int64("i", 21))
+	Sync()
+
+	var logged []int64
+	for _, e := range c.entries {
+		if e.message != "dial failed" {
+			continue
+		}
+		i := e.data[1].Int64()
+		logged = append(logged, i)
+		switch {
+		case i == 1 || i == 21:
+			if len(e.data) != 2 {
+				t.Errorf("occurrence %d: unexpected data %v", i, e.data)
+			}
+		case len(e.data) != 3 || e.data[2].Name() != "occurrences" || e.data[2].Uint64() != uint64(i):
+			t.Errorf("occurrence %d: unexpected data %v", i, e.data)
+		}
+	}
+	want := []int64{1, 2, 4, 8, 16, 21}
+	if len(logged) != len(want) {
+		t.Fatalf("logged occurrences %v, want %v", logged, want)
+	}
+	for i := range want {
+		if logged[i] != want[i] {
+			t.Fatalf("logged occurrences %v, want %v", logged, want)
+		}
+	}
+	if len(c.entries) != len(want)+1 {
+		t.Errorf("unexpected number of entries %d", len(c.entries))
+	}
+}
+
+func TestBackoffDedupCodecBoundsMessages(t *testing.T) {
+	const quiet = time.Minute
+	c := BackoffDedupCodec(&recordingCodec{}, quiet).(*backoffDedupCodec)
+	start := time.Now()
+	for i := 0; i < MaxBackoffMessages; i++ {
+		c.occurrence(strconv.Itoa(i), start)
+	}
+
+	// Without quiet messages, one message is forgotten for each new one.
+	c.occurrence("new", start)
+	if len(c.states) != MaxBackoffMessages {
+		t.Fatalf("recorded %d messages", len(c.states))
+	}
+
+	// Once quiet, all other messages are forgotten.
+	later := start.Add(quiet)
+	c.occurrence("new", later.Add(-time.Second))
+	c.occurrence("newer", later)
+	if len(c.states) != 2 || c.states["new"].count != 2 || c.states["newer"].count != 1 {
+		t.Errorf("unexpected states after eviction: %d messages", len(c.states))
+	}
+}
@@ -0,0 +1,138 @@
+// Copyright (c) 2017 Josh Rickmar
+// Use of this source code is governed by an ISC
+// license that can be found in the LICENSE file.
+
+package mill
+
+import (
+	"context"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// EntrySnapshot describes a single log entry of a batch (see LogBatch).
+type EntrySnapshot struct {
+	Time    time.Time
+	Tags    []KV
+	Message string
+	Data    []Data
+}
+
+// BatchCodec is an optional interface implemented by codecs that can encode
+// multiple log entries at once to amortize the per-entry cost of encoding and
+// writing.  Entries logged by LogBatch are passed to codecs implementing this
+// interface with a single call to EncodeLogEntries, while all other codecs
+// encode each entry using EncodeLogEntry.
+type BatchCodec interface {
+	Codec
+
+	// EncodeLogEntries encodes multiple log entries and writes them, in
+	// order, to an underlying writer.  The same requirements of
+	// EncodeLogEntry apply to the batch as a whole: encodeDone must be
+	// called once all entries have been encoded, after which the entries
+	// must not be referenced, and the entries must not be written until a
+	// read of the writeReady channel unblocks.
+	EncodeLogEntries(entries []EntrySnapshot, encodeDone func(), writeReady <-chan struct{})
+}
+
+// encodeEach encodes entries with the single-entry method of a codec, using
+// format if c is a format-switching codec.  Each entry is encoded concurrently,
+// and written in order once the previous entry has been written.
+func encodeEach(c Codec, format Format, entries []EntrySnapshot, encodeDone func(), writeReady <-chan struct{}) {
+	var encodes, writes sync.WaitGroup
+	encodes.Add(len(entries))
+	writes.Add(len(entries))
+	for i := range entries {
+		e := &entries[i]
+		next := make(chan struct{})
+		go func(writeReady <-chan struct{}) {
+			encodeLogEntry(c, format, e.Time, e.Tags, e.Message, e.Data, encodes.Done, writeReady)
+			close(next)
+			writes.Done()
+		}(writeReady)
+		writeReady = next
+	}
+	encodes.Wait()
+	encodeDone()
+	writes.Wait()
+}
+
+// LogBatch logs multiple entries to all attached loggers of the context.  The
+// entries are written consecutively, without entries of other calls to Log
+// between them, and each is logged with the tags of the context followed by
+// the tags of the entry.  Entries with a zero Time are timestamped with the
+// current time.  Codecs implementing BatchCodec receive all entries with a
+// single call.
+//
+// As with Log, LogBatch returns once all entries have been encoded.
+func LogBatch(ctx context.Context, entries ...EntrySnapshot) {
+	if ctx.Value(silenceKey{}) != nil || len(entries) == 0 {
+		return
+	}
+
+	var loggers []Codec
+	if v := ctx.Value(loggerKey{}); v != nil {
+		loggers = v.([]Codec)
+	}
+
+	var tags []KV
+	if v := ctx.Value(contextTags{}); v != nil {
+		tags = v.([]KV)
+	}
+
+	format := contextFormat(ctx)
+	batch := make([]EntrySnapshot, 0, len(entries))
+	for _, e := range entries {
+		if len(e.Tags) != 0 {
+			e.Tags = append(tags[:len(tags):len(tags)], e.Tags...)
+		} else {
+			e.Tags = tags
+		}
+		if len(loggers) == 0 {
+			bufferEarlyEntry(format, e.Time, e.Tags, e.Message, e.Data)
+			continue
+		}
+		e.Tags, e.Message, e.Data = intercept(e.Tags, e.Message, e.Data)
+		if bufferTxEntry(ctx, loggers, format, e.Time, e.Tags, e.Message, e.Data) {
+			continue
+		}
+		batch = append(batch, e)
+	}
+	if len(batch) != 0 {
+		logEntries(loggers, format, batch)
+	}
+}
+
+// logEntries encodes and writes multiple log entries to all loggers as a
+// single write, returning once all encoding has finished.  Format-switching
+// codecs encode the entries using format.
+func logEntries(loggers []Codec, format Format, entries []EntrySnapshot) {
+	start := time.Now()
+	acquirePendingWrite()
+
+	globalLogSyncer.mu.Lock()
+	entryReady := globalLogSyncer.writeReady
+	nextEntryReady := make(chan struct{})
+	globalLogSyncer.writeReady = nextEntryReady
+	now := time.Now()
+	utc := atomic.LoadInt32(&timestampsUTC) != 0
+	for i := range entries {
+		if entries[i].Time.IsZero() {
+			entries[i].Time = now
+		}
+		if utc {
+			entries[i].Time = entries[i].Time.UTC()
+		}
+	}
+	writeEntry(loggers, start, len(entries), entryReady, nextEntryReady, func(c Codec, encodeDone func(), writeReady <-chan struct{}) {
+		if ic, ok := c.(*independentCodec); ok {
+			c = ic.Codec
+		}
+		if bc, ok := c.(BatchCodec); ok {
+			bc.EncodeLogEntries(entries, encodeDone, writeReady)
+		} else {
+			encodeEach(c, format, entries, encodeDone, writeReady)
+		}
+	})
+}
@@ -0,0 +1,103 @@
+// Copyright (c) 2017 Josh Rickmar
+// Use of this source code is governed by an ISC
+// license that can be found in the LICENSE file.
+
+package mill
+
+import (
+	"bytes"
+	"context"
+	"testing"
+	"time"
+)
+
+// batchRecordingCodec records the entries of each call to EncodeLogEntries.
+type batchRecordingCodec struct {
+	recordingCodec
+	batches [][]recordedEntry
+}
+
+func (c *batchRecordingCodec) EncodeLogEntries(entries []EntrySnapshot, encodeDone func(), writeReady <-chan struct{}) {
+	batch := make([]recordedEntry, len(entries))
+	for i, e := range entries {
+		batch[i] = recordedEntry{
+			t:       e.Time,
+			tags:    append([]KV(nil), e.Tags...),
+			message: e.Message,
+			data:    CopyData(e.Data),
+		}
+	}
+	encodeDone()
+	<-writeReady
+	c.mu.Lock()
+	c.batches = append(c.batches, batch)
+	c.mu.Unlock()
+}
+
+func TestLogBatch(t *testing.T) {
+	batchCodec := &batchRecordingCodec{}
+	text := &bytes.Buffer{}
+	ctx := WithLogger(context.Background(), batchCodec)
+	ctx = WithLogger(ctx, TextCodec(text))
+	ctx = WithLogTag(ctx, "batch")
+
+	past := time.Now().Add(-time.Hour)
+	Log(ctx, "before")
+	LogBatch(ctx,
+		EntrySnapshot{Message: "first", Data: []Data{Int64("i", 1)}},
+		EntrySnapshot{Time: past, Tags: []KV{{"entry", "2"}}, Message: "second"},
+		EntrySnapshot{Message: "third"},
+	)
+	Log(ctx, "after")
+	Sync()
+
+	if len(batchCodec.batches) != 1 || len(batchCodec.batches[0]) != 3 {
+		t.Fatalf("unexpected batches %v", batchCodec.batches)
+	}
+	if len(batchCodec.entries) != 2 {
+		t.Errorf("unexpected single entries %v", batchCodec.entries)
+	}
+	batch := batchCodec.batches[0]
+	if batch[0].message != "first" || batch[0].data[0].Int64() != 1 || batch[0].t.IsZero() {
+		t.Errorf("unexpected first entry %v", batch[0])
+	}
+	if !batch[1].t.Equal(past) || len(batch[1].tags) != 2 || batch[1].tags[1].Key != "entry" {
+		t.Errorf("unexpected second entry %v", batch[1])
+	}
+
+	lines := bytes.Split(text.Bytes(), []byte("\n"))
+	want := []string{"[batch] before", "[batch] first, i=1", "[batch, entry=2] second", "[batch] third", "[batch] after", ""}
+	if len(lines) != len(want) {
+		t.Fatalf("unexpected text output %q", text.Bytes())
+	}
+	for i := range want {
+		if !bytes.HasSuffix(lines[i], []byte(want[i])) {
+			t.Errorf("line %d: %q, want suffix %q", i, lines[i], want[i])
+		}
+	}
+}
+
+func TestLogBatchBufferedTimes(t *testing.T) {
+	past := time.Now().Add(-time.Hour)
+	c := &recordingCodec{}
+	ctx, tx := WithBuffer(WithLogger(context.Background(), c))
+	LogBatch(ctx, EntrySnapshot{Time: past, Message: "buffered"}, EntrySnapshot{Message: "now"})
+	tx.Commit()
+
+	BufferEarly(10)
+	LogBatch(context.Background(), EntrySnapshot{Time: past, Message: "early"})
+	ReplayEarly(c)
+	Sync()
+
+	if len(c.entries) != 3 {
+		t.Fatalf("unexpected entries %v", c.entries)
+	}
+	for _, i := range []int{0, 2} {
+		if !c.entries[i].t.Equal(past) {
+			t.Errorf("%s entry: time %v, want %v", c.entries[i].message, c.entries[i].t, past)
+		}
+	}
+	if c.entries[1].t.Before(past.Add(time.Minute)) {
+		t.Errorf("entry without a time was not timestamped when logged: %v", c.entries[1].t)
+	}
+}
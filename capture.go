@@ -0,0 +1,62 @@
+// Copyright (c) 2017 Josh Rickmar
+// Use of this source code is governed by an ISC
+// license that can be found in the LICENSE file.
+
+package mill
+
+import (
+	"sync"
+	"time"
+)
+
+// Capture is a Codec that records log entries in memory rather than writing
+// them, so that they may later be replayed into another codec (see Replay).
+// For example, detailed entries of a request can be captured and only written
+// to a log file if the request fails.
+type Capture struct {
+	entries []EntrySnapshot
+	mu      sync.Mutex
+}
+
+// CaptureCodec creates a Capture with no captured entries.
+func CaptureCodec() *Capture {
+	return new(Capture)
+}
+
+// EncodeLogEntry implements the Codec interface.
+func (c *Capture) EncodeLogEntry(t time.Time, tags []KV, message string, data []Data, encodeDone func(), writeReady <-chan struct{}) {
+	e := EntrySnapshot{
+		Time:    t,
+		Tags:    append([]KV(nil), tags...),
+		Message: message,
+		Data:    CopyData(data),
+	}
+	encodeDone()
+	<-writeReady
+	c.mu.Lock()
+	c.entries = append(c.entries, e)
+	c.mu.Unlock()
+}
+
+// Entries returns all captured entries, in the order they were logged, and
+// removes them from the Capture.  Sync should be called first to include all
+// entries logged up to now.
+func (c *Capture) Entries() []EntrySnapshot {
+	c.mu.Lock()
+	entries := c.entries
+	c.entries = nil
+	c.mu.Unlock()
+	return entries
+}
+
+// Replay writes entries to c, in order and with their original timestamps
+// and tags, such as entries returned by Capture.Entries.  The entries are
+// written consecutively, as with LogBatch, and are ordered with all other log
+// entries.
+func Replay(c Codec, entries []EntrySnapshot) {
+	if len(entries) == 0 {
+		return
+	}
+	// logEntries may modify the timestamps of its entries.
+	logEntries([]Codec{c}, FormatText, append([]EntrySnapshot(nil), entries...))
+}
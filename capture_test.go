@@ -0,0 +1,41 @@
+// Copyright (c) 2017 Josh Rickmar
+// Use of this source code is governed by an ISC
+// license that can be found in the LICENSE file.
+
+package mill
+
+import (
+	"bytes"
+	"context"
+	"strconv"
+	"testing"
+	"time"
+)
+
+func TestCaptureReplay(t *testing.T) {
+	capture := CaptureCodec()
+	ctx := WithLogger(WithLogTagPair(context.Background(), "request", "1"), capture)
+	Log(ctx, "step 1", Int64("i", 1))
+	Log(ctx, "step 2", Int64("i", 2))
+	Sync()
+	entries := capture.Entries()
+	if len(entries) != 2 || len(capture.Entries()) != 0 {
+		t.Fatalf("unexpected captured entries %v", entries)
+	}
+
+	time.Sleep(2 * time.Millisecond)
+	buf := &bytes.Buffer{}
+	Replay(TextCodec(buf), entries)
+	Sync()
+
+	lines := bytes.Split(buf.Bytes(), []byte("\n"))
+	if len(lines) != 3 {
+		t.Fatalf("unexpected output %q", buf.Bytes())
+	}
+	for i, e := range entries {
+		want := e.Time.Format(TimeFormat) + " [request=1] " + e.Message + ", i=" + strconv.Itoa(i+1)
+		if string(lines[i]) != want {
+			t.Errorf("line %d: %q, want %q", i, lines[i], want)
+		}
+	}
+}
@@ -0,0 +1,347 @@
+// Copyright (c) 2017 Josh Rickmar
+// Use of this source code is governed by an ISC
+// license that can be found in the LICENSE file.
+
+// Package cloudwatch implements a mill codec which writes log entries to AWS
+// CloudWatch Logs using the PutLogEvents API.
+//
+// To avoid a dependency on any particular version of the AWS SDK, the codec
+// calls PutLogEvents through the Client interface, which is implemented by a
+// small adapter around the SDK's CloudWatch Logs client.  Adapters must return
+// an *InvalidSequenceTokenError or *DataAlreadyAcceptedError for the
+// corresponding API errors, and ErrThrottled for throttling errors.
+package cloudwatch
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/jrick/mill"
+)
+
+// API limits of PutLogEvents.  Event messages longer than MaxEventBytes are
+// truncated.
+const (
+	MaxBatchEvents = 10000
+	MaxBatchBytes  = 1048576
+	EventOverhead  = 26
+	MaxEventBytes  = 262144 - EventOverhead
+)
+
+// DefaultRetryWait is the default delay before the first retry of a failed
+// PutLogEvents call.
+const DefaultRetryWait = 200 * time.Millisecond
+
+var defaultNewCodec = mill.TextCodec
+
+// InputLogEvent is a single log event of a PutLogEvents call.
+type InputLogEvent struct {
+	Message   string
+	Timestamp int64 // milliseconds since the Unix epoch
+}
+
+// PutLogEventsInput describes the input of a PutLogEvents call.
+type PutLogEventsInput struct {
+	LogGroupName  string
+	LogStreamName string
+	LogEvents     []InputLogEvent
+	SequenceToken *string
+}
+
+// PutLogEventsOutput describes the output of a PutLogEvents call.
+type PutLogEventsOutput struct {
+	NextSequenceToken *string
+}
+
+// Client calls the CloudWatch Logs PutLogEvents API.
+type Client interface {
+	PutLogEvents(ctx context.Context, input *PutLogEventsInput) (*PutLogEventsOutput, error)
+}
+
+// InvalidSequenceTokenError is returned by a Client when the sequence token of
+// a PutLogEvents call is not the expected token.
+type InvalidSequenceTokenError struct {
+	ExpectedSequenceToken *string
+}
+
+func (e *InvalidSequenceTokenError) Error() string {
+	return "cloudwatch: invalid sequence token"
+}
+
+// DataAlreadyAcceptedError is returned by a Client when the events of a
+// PutLogEvents call were previously accepted.
+type DataAlreadyAcceptedError struct {
+	ExpectedSequenceToken *string
+}
+
+func (e *DataAlreadyAcceptedError) Error() string {
+	return "cloudwatch: data already accepted"
+}
+
+// ErrThrottled is returned by a Client when a PutLogEvents call is throttled.
+var ErrThrottled = errors.New("cloudwatch: request throttled")
+
+// ErrClosed is returned when flushing a closed Batcher.
+var ErrClosed = errors.New("cloudwatch: batcher is closed")
+
+// Options describes the batching and delivery behavior of a Batcher.  Zero
+// values, other than Client, are replaced with defaults.
+type Options struct {
+	// Client calls PutLogEvents and must be set.
+	Client Client
+
+	// NewCodec creates the codec used to encode each entry as the message of
+	// a log event, and is called once per entry.  The codec must write the
+	// entry using a single Write.  Defaults to mill.JSONCodec, or
+	// mill.TextCodec if built with the nojson tag.
+	NewCodec func(io.Writer) mill.Codec
+
+	// MaxBatchEvents and MaxBatchBytes limit the size of each PutLogEvents
+	// call, and default to the API limits.  Event sizes include the API's
+	// per-event overhead.
+	MaxBatchEvents int
+	MaxBatchBytes  int
+
+	// FlushInterval is the interval at which any partial batch is sent.
+	// Defaults to 5 seconds.
+	FlushInterval time.Duration
+
+	// MaxRetries is the number of times a throttled or failed call is
+	// retried before the batch is discarded.  Defaults to 5, and a negative
+	// value disables retries.
+	MaxRetries int
+
+	// RetryBackoff is the delay before the first retry, and is doubled for
+	// every following retry.  Defaults to DefaultRetryWait.
+	RetryBackoff time.Duration
+}
+
+// Batcher is a mill.Codec which batches log entries and puts them to a
+// CloudWatch Logs stream.
+type Batcher struct {
+	group, stream string
+	opts          Options
+
+	events []InputLogEvent
+	size   int
+	token  *string
+	closed bool
+	mu     sync.Mutex
+
+	full    chan struct{}
+	flushes chan chan error
+	quit    chan struct{}
+	done    chan struct{}
+	closing sync.Once
+}
+
+// LogsCodec creates a Batcher which puts log entries to the CloudWatch Logs
+// stream of a log group.  Batches are sent whenever a batch limit is reached or
+// the flush interval elapses.
+//
+// mill.Sync flushes the batcher, delivering all entries logged up to now.
+// Flush may be called instead to observe delivery errors.  Close must be called
+// to deliver any final batch and release the background goroutine.
+func LogsCodec(group, stream string, opts Options) *Batcher {
+	if opts.NewCodec == nil {
+		opts.NewCodec = defaultNewCodec
+	}
+	if opts.MaxBatchEvents <= 0 || opts.MaxBatchEvents > MaxBatchEvents {
+		opts.MaxBatchEvents = MaxBatchEvents
+	}
+	if opts.MaxBatchBytes <= 0 || opts.MaxBatchBytes > MaxBatchBytes {
+		opts.MaxBatchBytes = MaxBatchBytes
+	}
+	if opts.FlushInterval <= 0 {
+		opts.FlushInterval = 5 * time.Second
+	}
+	if opts.MaxRetries < 0 {
+		opts.MaxRetries = 0
+	} else if opts.MaxRetries == 0 {
+		opts.MaxRetries = 5
+	}
+	if opts.RetryBackoff <= 0 {
+		opts.RetryBackoff = DefaultRetryWait
+	}
+	c := &Batcher{
+		group:   group,
+		stream:  stream,
+		opts:    opts,
+		full:    make(chan struct{}, 1),
+		flushes: make(chan chan error),
+		quit:    make(chan struct{}),
+		done:    make(chan struct{}),
+	}
+	go c.run()
+	mill.FlushOnSync(c, true)
+	return c
+}
+
+// EncodeLogEntry implements the mill.Codec interface.
+func (c *Batcher) EncodeLogEntry(t time.Time, tags []mill.KV, message string, data []mill.Data, encodeDone func(), writeReady <-chan struct{}) {
+	// Each entry is encoded by its own codec so that the write of the
+	// message is added with the entry's timestamp.
+	inner := c.opts.NewCodec(eventWriter{c, t})
+	inner.EncodeLogEntry(t, tags, message, data, encodeDone, writeReady)
+}
+
+type eventWriter struct {
+	c *Batcher
+	t time.Time
+}
+
+func (w eventWriter) Write(p []byte) (int, error) {
+	w.c.addEvent(w.t, p)
+	return len(p), nil
+}
+
+func (c *Batcher) addEvent(t time.Time, p []byte) {
+	p = bytes.TrimSuffix(p, []byte{'\n'})
+	if len(p) > MaxEventBytes {
+		p = p[:MaxEventBytes]
+	}
+	e := InputLogEvent{
+		Message:   string(p),
+		Timestamp: t.UnixNano() / int64(time.Millisecond),
+	}
+
+	c.mu.Lock()
+	if c.closed {
+		c.mu.Unlock()
+		return
+	}
+	c.events = append(c.events, e)
+	c.size += len(e.Message) + EventOverhead
+	full := len(c.events) >= c.opts.MaxBatchEvents || c.size >= c.opts.MaxBatchBytes
+	c.mu.Unlock()
+	if full {
+		select {
+		case c.full <- struct{}{}:
+		default:
+		}
+	}
+}
+
+func (c *Batcher) run() {
+	ticker := time.NewTicker(c.opts.FlushInterval)
+	defer ticker.Stop()
+	defer close(c.done)
+	for {
+		select {
+		case <-ticker.C:
+			c.send()
+		case <-c.full:
+			c.send()
+		case errc := <-c.flushes:
+			errc <- c.send()
+		case <-c.quit:
+			return
+		}
+	}
+}
+
+// Flush puts all pending events, returning the first error if any batch could
+// not be delivered.
+func (c *Batcher) Flush() error {
+	errc := make(chan error, 1)
+	select {
+	case c.flushes <- errc:
+		return <-errc
+	case <-c.done:
+		return ErrClosed
+	}
+}
+
+// Close waits for all entries logged before Close to be written, flushes them,
+// and stops the background sender.  Entries written after Close are dropped.
+func (c *Batcher) Close() error {
+	err := ErrClosed
+	c.closing.Do(func() {
+		mill.FlushOnSync(c, false)
+		mill.Sync()
+		c.mu.Lock()
+		c.closed = true
+		c.mu.Unlock()
+		err = c.Flush()
+		close(c.quit)
+		<-c.done
+	})
+	return err
+}
+
+// eventsByTime sorts events by their timestamps.
+type eventsByTime []InputLogEvent
+
+func (e eventsByTime) Len() int           { return len(e) }
+func (e eventsByTime) Less(i, j int) bool { return e[i].Timestamp < e[j].Timestamp }
+func (e eventsByTime) Swap(i, j int)      { e[i], e[j] = e[j], e[i] }
+
+// send puts all pending events, sorted by timestamp as required by
+// PutLogEvents and split into batches within the batch limits.  It must only
+// be called by the run goroutine.
+func (c *Batcher) send() error {
+	c.mu.Lock()
+	pending := c.events
+	c.events = nil
+	c.size = 0
+	c.mu.Unlock()
+	sort.Stable(eventsByTime(pending))
+
+	var err error
+	for len(pending) != 0 {
+		n, size := 0, 0
+		for n < len(pending) && n < c.opts.MaxBatchEvents {
+			eventSize := len(pending[n].Message) + EventOverhead
+			if n != 0 && size+eventSize > c.opts.MaxBatchBytes {
+				break
+			}
+			size += eventSize
+			n++
+		}
+		if e := c.put(pending[:n]); e != nil && err == nil {
+			err = e
+		}
+		pending = pending[n:]
+	}
+	return err
+}
+
+// put calls PutLogEvents for a single batch, following the expected sequence
+// token on sequence token errors and retrying with exponential backoff when
+// throttled or failed.
+func (c *Batcher) put(events []InputLogEvent) error {
+	backoff := c.opts.RetryBackoff
+	for attempt := 0; ; attempt++ {
+		out, err := c.opts.Client.PutLogEvents(context.Background(), &PutLogEventsInput{
+			LogGroupName:  c.group,
+			LogStreamName: c.stream,
+			LogEvents:     events,
+			SequenceToken: c.token,
+		})
+		switch e := err.(type) {
+		case nil:
+			c.token = out.NextSequenceToken
+			return nil
+		case *DataAlreadyAcceptedError:
+			c.token = e.ExpectedSequenceToken
+			return nil
+		case *InvalidSequenceTokenError:
+			c.token = e.ExpectedSequenceToken
+			if attempt == c.opts.MaxRetries {
+				return err
+			}
+			continue
+		}
+		if attempt == c.opts.MaxRetries {
+			return fmt.Errorf("cloudwatch: PutLogEvents failed after %d attempts: %v", attempt+1, err)
+		}
+		time.Sleep(backoff)
+		backoff *= 2
+	}
+}
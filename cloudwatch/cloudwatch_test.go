@@ -0,0 +1,249 @@
+// Copyright (c) 2017 Josh Rickmar
+// Use of this source code is governed by an ISC
+// license that can be found in the LICENSE file.
+
+package cloudwatch
+
+import (
+	"context"
+	"strconv"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/jrick/mill"
+)
+
+type putCall struct {
+	events []InputLogEvent
+	token  string
+}
+
+type mockClient struct {
+	calls     []putCall
+	token     int
+	throttles int
+	mu        sync.Mutex
+}
+
+func (m *mockClient) PutLogEvents(ctx context.Context, input *PutLogEventsInput) (*PutLogEventsOutput, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	var token string
+	if input.SequenceToken != nil {
+		token = *input.SequenceToken
+	}
+	m.calls = append(m.calls, putCall{input.LogEvents, token})
+	if m.throttles > 0 {
+		m.throttles--
+		return nil, ErrThrottled
+	}
+	expected := strconv.Itoa(m.token)
+	if m.token != 0 && token != expected {
+		return nil, &InvalidSequenceTokenError{ExpectedSequenceToken: &expected}
+	}
+	m.token++
+	next := strconv.Itoa(m.token)
+	return &PutLogEventsOutput{NextSequenceToken: &next}, nil
+}
+
+func TestLogsCodecBatching(t *testing.T) {
+	client := &mockClient{}
+	c := LogsCodec("group", "stream", Options{
+		Client:         client,
+		NewCodec:       mill.TextCodec,
+		MaxBatchEvents: 3,
+		FlushInterval:  time.Hour,
+	})
+	ctx := mill.WithLogger(context.Background(), c)
+	start := time.Now()
+	for i := 0; i < 7; i++ {
+		mill.Log(ctx, "message", mill.Int64("i", int64(i)))
+	}
+	mill.Sync()
+	if err := c.Close(); err != nil {
+		t.Fatal(err)
+	}
+
+	var n int
+	for i, call := range client.calls {
+		if len(call.events) > 3 {
+			t.Errorf("call %d: batch of %d events exceeds limit", i, len(call.events))
+		}
+		if want := strconv.Itoa(i); i != 0 && call.token != want {
+			t.Errorf("call %d: sequence token %q, expected %q", i, call.token, want)
+		}
+		for _, e := range call.events {
+			if !strings.HasSuffix(e.Message, "message, i="+strconv.Itoa(n)) {
+				t.Errorf("event %d: unexpected message %q", n, e.Message)
+			}
+			if e.Timestamp < start.UnixNano()/int64(time.Millisecond) {
+				t.Errorf("event %d: timestamp %d before start", n, e.Timestamp)
+			}
+			n++
+		}
+	}
+	if n != 7 {
+		t.Errorf("expected 7 events, got %d", n)
+	}
+}
+
+func TestLogsCodecBatchBytes(t *testing.T) {
+	client := &mockClient{}
+	c := LogsCodec("group", "stream", Options{
+		Client:        client,
+		NewCodec:      mill.TextCodec,
+		MaxBatchBytes: 300,
+		FlushInterval: time.Hour,
+	})
+	defer c.Close()
+	ctx := mill.WithLogger(context.Background(), c)
+	for i := 0; i < 4; i++ {
+		mill.Log(ctx, strings.Repeat("x", 100))
+	}
+	mill.Sync()
+	if err := c.Flush(); err != nil {
+		t.Fatal(err)
+	}
+
+	var n int
+	for i, call := range client.calls {
+		var size int
+		for _, e := range call.events {
+			size += len(e.Message) + EventOverhead
+		}
+		if size > 300 {
+			t.Errorf("call %d: batch of %d bytes exceeds limit", i, size)
+		}
+		n += len(call.events)
+	}
+	if n != 4 {
+		t.Errorf("expected 4 events, got %d", n)
+	}
+}
+
+func TestLogsCodecSequenceRecovery(t *testing.T) {
+	// Another writer to the stream has advanced the sequence token.
+	client := &mockClient{token: 5}
+	c := LogsCodec("group", "stream", Options{
+		Client:        client,
+		FlushInterval: time.Hour,
+	})
+	defer c.Close()
+	ctx := mill.WithLogger(context.Background(), c)
+	mill.Log(ctx, "message")
+	mill.Sync()
+	if err := c.Flush(); err != nil {
+		t.Fatal(err)
+	}
+
+	if len(client.calls) != 2 || client.calls[1].token != "5" {
+		t.Errorf("expected retry with expected sequence token, got %+v", client.calls)
+	}
+}
+
+func TestLogsCodecThrottling(t *testing.T) {
+	client := &mockClient{throttles: 2}
+	c := LogsCodec("group", "stream", Options{
+		Client:        client,
+		FlushInterval: time.Hour,
+		RetryBackoff:  time.Millisecond,
+	})
+	defer c.Close()
+	ctx := mill.WithLogger(context.Background(), c)
+	mill.Log(ctx, "message")
+	mill.Sync()
+	if err := c.Flush(); err != nil {
+		t.Fatal(err)
+	}
+	if len(client.calls) != 3 || client.token != 1 {
+		t.Errorf("expected delivery after 3 attempts, got %d attempts", len(client.calls))
+	}
+
+	// Sync would consume the delivery error, so only wait for the write.
+	client.throttles = 10
+	c.opts.MaxRetries = 1
+	mill.Log(ctx, "message")
+	if err := mill.FlushCodec(c); err == nil {
+		t.Error("expected error after exhausting retries")
+	}
+}
+
+func TestLogsCodecSortsEvents(t *testing.T) {
+	client := &mockClient{}
+	c := LogsCodec("group", "stream", Options{
+		Client:        client,
+		NewCodec:      mill.TextCodec,
+		FlushInterval: time.Hour,
+	})
+	defer c.Close()
+	ctx := mill.WithLogger(context.Background(), c)
+	base := time.Unix(1500000000, 0)
+	mill.LogBatch(ctx,
+		mill.EntrySnapshot{Time: base.Add(2 * time.Second), Message: "third"},
+		mill.EntrySnapshot{Time: base, Message: "first"},
+		mill.EntrySnapshot{Time: base.Add(time.Second), Message: "second"},
+	)
+	mill.Sync()
+	if err := c.Flush(); err != nil {
+		t.Fatal(err)
+	}
+
+	if len(client.calls) != 1 || len(client.calls[0].events) != 3 {
+		t.Fatalf("unexpected calls %+v", client.calls)
+	}
+	for i, want := range []string{"first", "second", "third"} {
+		e := client.calls[0].events[i]
+		if !strings.HasSuffix(e.Message, "] "+want) {
+			t.Errorf("event %d: unexpected message %q", i, e.Message)
+		}
+		if ts := base.Add(time.Duration(i)*time.Second).UnixNano() / int64(time.Millisecond); e.Timestamp != ts {
+			t.Errorf("event %d: timestamp %d, expected %d", i, e.Timestamp, ts)
+		}
+	}
+}
+
+func TestLogsCodecSyncFlushes(t *testing.T) {
+	client := &mockClient{}
+	c := LogsCodec("group", "stream", Options{
+		Client:        client,
+		FlushInterval: time.Hour,
+	})
+	defer c.Close()
+	ctx := mill.WithLogger(context.Background(), c)
+	mill.Log(ctx, "message")
+	mill.Sync()
+
+	client.mu.Lock()
+	defer client.mu.Unlock()
+	if len(client.calls) != 1 || len(client.calls[0].events) != 1 {
+		t.Errorf("expected event delivered by Sync, got %+v", client.calls)
+	}
+}
+
+func TestLogsCodecDropsAfterClose(t *testing.T) {
+	client := &mockClient{}
+	c := LogsCodec("group", "stream", Options{
+		Client:        client,
+		FlushInterval: time.Hour,
+	})
+	if err := c.Close(); err != nil {
+		t.Fatal(err)
+	}
+	ctx := mill.WithLogger(context.Background(), c)
+	for i := 0; i < 10; i++ {
+		mill.Log(ctx, "message")
+	}
+	mill.Sync()
+
+	c.mu.Lock()
+	pending := len(c.events)
+	c.mu.Unlock()
+	if pending != 0 {
+		t.Errorf("%d events buffered after Close", pending)
+	}
+	if err := c.Flush(); err != ErrClosed {
+		t.Errorf("unexpected Flush error %v", err)
+	}
+}
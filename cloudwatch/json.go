@@ -0,0 +1,13 @@
+// Copyright (c) 2017 Josh Rickmar
+// Use of this source code is governed by an ISC
+// license that can be found in the LICENSE file.
+
+//+build !nojson
+
+package cloudwatch
+
+import "github.com/jrick/mill"
+
+func init() {
+	defaultNewCodec = mill.JSONCodec
+}
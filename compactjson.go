@@ -0,0 +1,176 @@
+// Copyright (c) 2017 Josh Rickmar
+// Use of this source code is governed by an ISC
+// license that can be found in the LICENSE file.
+
+//+build !nojson
+
+package mill
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"time"
+)
+
+// CompactJSONAliases describes the keys used by a compact JSON codec for the
+// fields of each entry.  Empty aliases are replaced with the defaults listed
+// for each field.  Aliases, after replacing defaults, must be distinct.
+type CompactJSONAliases struct {
+	Time    string // Default "t"
+	Tags    string // Default "g"
+	Event   string // Default "e"
+	Message string // Default "m"
+	Data    string // Default "d"
+}
+
+func (a *CompactJSONAliases) setDefaults() {
+	if a.Time == "" {
+		a.Time = "t"
+	}
+	if a.Tags == "" {
+		a.Tags = "g"
+	}
+	if a.Event == "" {
+		a.Event = "e"
+	}
+	if a.Message == "" {
+		a.Message = "m"
+	}
+	if a.Data == "" {
+		a.Data = "d"
+	}
+}
+
+// validate sets the default aliases and checks that the aliases are distinct.
+func (a *CompactJSONAliases) validate() error {
+	a.setDefaults()
+	seen := make(map[string]struct{}, 5)
+	for _, alias := range []string{a.Time, a.Tags, a.Event, a.Message, a.Data} {
+		if _, ok := seen[alias]; ok {
+			return fmt.Errorf("mill: compact JSON alias %q is used for multiple fields", alias)
+		}
+		seen[alias] = struct{}{}
+	}
+	return nil
+}
+
+type compactJSONCodec struct {
+	writer  io.Writer
+	aliases CompactJSONAliases
+}
+
+// JSONCodecCompact creates a Codec that writes encoded log entries to w as JSON
+// objects optimized for size, such as for shipping logs over constrained links.
+// Fields are keyed by the short aliases, the timestamp is recorded only as an
+// integer count of nanoseconds since the Unix epoch, and the tags, event,
+// message, and data fields are omitted when empty.  The message of an event
+// (see Event) is also omitted when it is the event name.  Data values are
+// encoded the same as JSONCodec.
+//
+// As with JSONCodec, each entry is written with a single Write and is not
+// terminated.  Entries can be newline terminated using FramingCodec:
+//
+//	c := mill.FramingCodec(w, nil, []byte{'\n'}, func(w io.Writer) mill.Codec {
+//		c, _ := mill.JSONCodecCompact(w, aliases)
+//		return c
+//	})
+//
+// Since the aliased keys are not self-describing, entries should be decoded
+// using DecodeCompactJSON with the same aliases.  An error is returned if the
+// aliases are not distinct.
+func JSONCodecCompact(w io.Writer, aliases CompactJSONAliases) (Codec, error) {
+	if err := aliases.validate(); err != nil {
+		return nil, err
+	}
+	return &compactJSONCodec{writer: w, aliases: aliases}, nil
+}
+
+func (c *compactJSONCodec) encode(t time.Time, tags []KV, message string, data []Data) ([]byte, error) {
+	a := &c.aliases
+	r := make(map[string]interface{}, 5)
+	r[a.Time] = t.UnixNano()
+	if len(tags) != 0 {
+		r[a.Tags] = mapKV(tags)
+	}
+	event := eventName(data)
+	if event != "" {
+		r[a.Event] = event
+	}
+	if message != event {
+		r[a.Message] = message
+	}
+	if m := mapData(tags, data); len(m) != 0 {
+		r[a.Data] = m
+	}
+	return json.Marshal(r)
+}
+
+func (c *compactJSONCodec) EncodeLogEntry(t time.Time, tags []KV, message string, data []Data, encodeDone func(), writeReady <-chan struct{}) {
+	b, err := c.encode(t, tags, message, data)
+	encodeDone()
+	<-writeReady
+	if err != nil {
+		return
+	}
+	c.writer.Write(b)
+}
+
+// Flush flushes the underlying writer if it implements Flusher.
+func (c *compactJSONCodec) Flush() error {
+	if f, ok := c.writer.(Flusher); ok {
+		return f.Flush()
+	}
+	return nil
+}
+
+// CompactJSONEntry is a log entry decoded by DecodeCompactJSON.  Tags are
+// described as written by the JSON codecs, with tag pairs formatted as
+// key=value.
+type CompactJSONEntry struct {
+	Time    time.Time
+	Tags    []string
+	Event   string
+	Message string
+	Data    map[string]interface{}
+}
+
+// DecodeCompactJSON decodes a single log entry written by a codec created by
+// JSONCodecCompact with the same aliases.  Data values are decoded by the
+// rules of json.Unmarshal for an empty interface.  The message of an event
+// entry without an encoded message is the event name.
+func DecodeCompactJSON(b []byte, aliases CompactJSONAliases) (*CompactJSONEntry, error) {
+	if err := aliases.validate(); err != nil {
+		return nil, err
+	}
+	var fields map[string]json.RawMessage
+	if err := json.Unmarshal(b, &fields); err != nil {
+		return nil, err
+	}
+	e := new(CompactJSONEntry)
+	var nanos int64
+	decode := []struct {
+		key string
+		v   interface{}
+	}{
+		{aliases.Time, &nanos},
+		{aliases.Tags, &e.Tags},
+		{aliases.Event, &e.Event},
+		{aliases.Message, &e.Message},
+		{aliases.Data, &e.Data},
+	}
+	for _, d := range decode {
+		raw, ok := fields[d.key]
+		if !ok {
+			continue
+		}
+		if err := json.Unmarshal(raw, d.v); err != nil {
+			return nil, err
+		}
+	}
+	if _, ok := fields[aliases.Message]; !ok {
+		e.Message = e.Event
+	}
+	e.Time = time.Unix(0, nanos)
+	return e, nil
+}
@@ -0,0 +1,96 @@
+// Copyright (c) 2017 Josh Rickmar
+// Use of this source code is governed by an ISC
+// license that can be found in the LICENSE file.
+
+//+build !nojson
+
+package mill
+
+import (
+	"bytes"
+	"context"
+	"io"
+	"reflect"
+	"testing"
+)
+
+func TestJSONCodecCompact(t *testing.T) {
+	aliases := CompactJSONAliases{Message: "msg"}
+	compact, full := &bytes.Buffer{}, &bytes.Buffer{}
+	rec := &recordingCodec{}
+	if _, err := JSONCodecCompact(compact, aliases); err != nil {
+		t.Fatal(err)
+	}
+	c := FramingCodec(compact, nil, []byte{'\n'}, func(w io.Writer) Codec {
+		c, _ := JSONCodecCompact(w, aliases)
+		return c
+	})
+	ctx := WithLogger(context.Background(), c)
+	ctx = WithLogger(ctx, JSONCodec(full))
+	ctx = WithLogger(ctx, rec)
+	Log(WithLogTagPair(ctx, "request", "7"), "handled", Int64("status", 200), String("path", "/"))
+	Event(ctx, "user_signup")
+	Log(ctx, "")
+	Sync()
+
+	if compact.Len() >= full.Len()*2/3 {
+		t.Errorf("compact output is %d bytes, full output is %d bytes", compact.Len(), full.Len())
+	}
+
+	lines := bytes.SplitAfter(compact.Bytes(), []byte("\n"))
+	if len(lines) != 4 || len(lines[3]) != 0 {
+		t.Fatalf("unexpected output %q", compact.Bytes())
+	}
+	if want := []byte(`{"t":`); !bytes.HasPrefix(lines[2], want) || bytes.Contains(lines[2], []byte(",")) {
+		t.Errorf("empty fields not omitted: %s", lines[2])
+	}
+	if bytes.Contains(lines[1], []byte(`"msg"`)) {
+		t.Errorf("event name duplicated as message: %s", lines[1])
+	}
+
+	want := []CompactJSONEntry{
+		{Tags: []string{"request=7"}, Message: "handled", Data: map[string]interface{}{"status": 200.0, "path": "/"}},
+		{Event: "user_signup", Message: "user_signup"},
+		{},
+	}
+	for i := range want {
+		e, err := DecodeCompactJSON(lines[i], aliases)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if !e.Time.Equal(rec.entries[i].t) {
+			t.Errorf("entry %d: time %v, want %v", i, e.Time, rec.entries[i].t)
+		}
+		want[i].Time = e.Time
+		if !reflect.DeepEqual(*e, want[i]) {
+			t.Errorf("entry %d: decoded %+v, want %+v", i, *e, want[i])
+		}
+	}
+}
+
+func TestJSONCodecCompactDuplicateAliases(t *testing.T) {
+	for _, aliases := range []CompactJSONAliases{
+		{Message: "d"},
+		{Time: "x", Data: "x"},
+	} {
+		if _, err := JSONCodecCompact(&bytes.Buffer{}, aliases); err == nil {
+			t.Errorf("aliases %+v: expected error", aliases)
+		}
+		if _, err := DecodeCompactJSON([]byte(`{}`), aliases); err == nil {
+			t.Errorf("aliases %+v: expected decode error", aliases)
+		}
+	}
+}
+
+func TestJSONCodecCompactUnterminated(t *testing.T) {
+	buf := &bytes.Buffer{}
+	c, err := JSONCodecCompact(buf, CompactJSONAliases{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	Log(WithLogger(context.Background(), c), "message")
+	Sync()
+	if !bytes.HasSuffix(buf.Bytes(), []byte("}")) {
+		t.Errorf("entry is terminated: %q", buf.Bytes())
+	}
+}
@@ -0,0 +1,188 @@
+// Copyright (c) 2017 Josh Rickmar
+// Use of this source code is governed by an ISC
+// license that can be found in the LICENSE file.
+
+package mill
+
+import (
+	"encoding"
+	"fmt"
+	"reflect"
+	"sort"
+	"strings"
+	"unicode"
+)
+
+// Redacted is the value recorded in place of sensitive configuration values.
+const Redacted = "[REDACTED]"
+
+// sensitiveConfigNames are the words of configuration keys whose values are
+// redacted by Config.
+var sensitiveConfigNames = []string{"password", "passwd", "secret", "token", "key"}
+
+// Config returns data describing an application's effective configuration,
+// typically logged once at startup.  Each configuration value is recorded as a
+// data field named by its key, ordered by key.  The values of keys containing
+// (case-insensitively) the word password, passwd, secret, token, or key, or
+// their plurals, are replaced with Redacted.  Words of keys are separated by
+// non-alphanumeric characters and by changes from lower to upper case, so
+// db_password, APIKey, and session.token are redacted, while monkey and
+// keyboard are not.
+//
+// Nested maps and structs (other than those implementing fmt.Stringer, error,
+// or encoding.TextMarshaler) are redacted at every level.  These are recorded
+// as maps of their keys or exported field names.  Map keys that are not
+// strings, such as the interface{} keys of maps decoded from YAML, are
+// formatted with fmt.Sprint.
+func Config(m map[string]interface{}) []Data {
+	keys := make([]string, 0, len(m))
+	for k := range m {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+
+	data := make([]Data, len(keys))
+	for i, k := range keys {
+		if sensitiveConfigKey(k) {
+			data[i] = String(k, Redacted)
+			continue
+		}
+		switch v := m[k].(type) {
+		case string:
+			data[i] = String(k, v)
+		default:
+			data[i] = Any(k, redactConfigValue(reflect.ValueOf(v), make(map[uintptr]bool)))
+		}
+	}
+	return data
+}
+
+var (
+	stringerType      = reflect.TypeOf((*fmt.Stringer)(nil)).Elem()
+	errorType         = reflect.TypeOf((*error)(nil)).Elem()
+	textMarshalerType = reflect.TypeOf((*encoding.TextMarshaler)(nil)).Elem()
+)
+
+// redactConfigValue returns v with the values of sensitive keys of all nested
+// maps and structs redacted.  Maps and structs are returned as
+// map[string]interface{}, and slices and arrays containing them as
+// []interface{}.  Pointers already visited by an outer value are returned
+// unchanged to break cycles.
+func redactConfigValue(v reflect.Value, seen map[uintptr]bool) interface{} {
+	if !v.IsValid() {
+		return nil
+	}
+	t := v.Type()
+	if t.Implements(stringerType) || t.Implements(errorType) || t.Implements(textMarshalerType) {
+		return v.Interface()
+	}
+	switch v.Kind() {
+	case reflect.Interface:
+		if v.IsNil() {
+			return nil
+		}
+		return redactConfigValue(v.Elem(), seen)
+	case reflect.Ptr:
+		if v.IsNil() || seen[v.Pointer()] {
+			break
+		}
+		seen[v.Pointer()] = true
+		defer delete(seen, v.Pointer())
+		return redactConfigValue(v.Elem(), seen)
+	case reflect.Map:
+		if v.IsNil() || seen[v.Pointer()] {
+			break
+		}
+		seen[v.Pointer()] = true
+		defer delete(seen, v.Pointer())
+		m := make(map[string]interface{}, v.Len())
+		for _, k := range v.MapKeys() {
+			var name string
+			if k.Kind() == reflect.String {
+				name = k.String()
+			} else {
+				name = fmt.Sprint(k.Interface())
+			}
+			m[name] = redactConfigField(name, v.MapIndex(k), seen)
+		}
+		return m
+	case reflect.Struct:
+		m := make(map[string]interface{}, v.NumField())
+		for i := 0; i < v.NumField(); i++ {
+			f := t.Field(i)
+			if f.PkgPath != "" { // unexported
+				continue
+			}
+			m[f.Name] = redactConfigField(f.Name, v.Field(i), seen)
+		}
+		return m
+	case reflect.Slice, reflect.Array:
+		if !mayContainConfig(t.Elem()) || (v.Kind() == reflect.Slice && v.IsNil()) {
+			break
+		}
+		s := make([]interface{}, v.Len())
+		for i := range s {
+			s[i] = redactConfigValue(v.Index(i), seen)
+		}
+		return s
+	}
+	if !v.CanInterface() {
+		return nil
+	}
+	return v.Interface()
+}
+
+func redactConfigField(name string, v reflect.Value, seen map[uintptr]bool) interface{} {
+	if sensitiveConfigKey(name) {
+		return Redacted
+	}
+	return redactConfigValue(v, seen)
+}
+
+// mayContainConfig returns whether values of type t may contain maps or
+// structs.
+func mayContainConfig(t reflect.Type) bool {
+	switch t.Kind() {
+	case reflect.Interface, reflect.Ptr, reflect.Map, reflect.Struct, reflect.Slice, reflect.Array:
+		return true
+	}
+	return false
+}
+
+// sensitiveConfigKey returns whether any word of the key k is a sensitive
+// configuration name.
+func sensitiveConfigKey(k string) bool {
+	isSensitive := func(word string) bool {
+		word = strings.ToLower(word)
+		for _, s := range sensitiveConfigNames {
+			if word == s || word == s+"s" {
+				return true
+			}
+		}
+		return false
+	}
+	wordStart := 0
+	runes := []rune(k)
+	for i, r := range runes {
+		switch {
+		case !unicode.IsLetter(r) && !unicode.IsDigit(r):
+			if isSensitive(string(runes[wordStart:i])) {
+				return true
+			}
+			wordStart = i + 1
+		case i > wordStart && unicode.IsUpper(r) && !unicode.IsUpper(runes[i-1]):
+			// camelCase boundary: fooBar
+			if isSensitive(string(runes[wordStart:i])) {
+				return true
+			}
+			wordStart = i
+		case i > wordStart+1 && unicode.IsLower(r) && unicode.IsUpper(runes[i-1]) && unicode.IsUpper(runes[i-2]):
+			// acronym boundary: APIKey
+			if isSensitive(string(runes[wordStart : i-1])) {
+				return true
+			}
+			wordStart = i - 1
+		}
+	}
+	return isSensitive(string(runes[wordStart:]))
+}
@@ -0,0 +1,116 @@
+// Copyright (c) 2017 Josh Rickmar
+// Use of this source code is governed by an ISC
+// license that can be found in the LICENSE file.
+
+package mill
+
+import (
+	"bytes"
+	"context"
+	"testing"
+)
+
+func TestConfig(t *testing.T) {
+	m := map[string]interface{}{
+		"listen":        ":8080",
+		"db_password":   "hunter2",
+		"APIKey":        "abc",
+		"workers":       4,
+		"session.token": "xyz",
+		"debug":         false,
+	}
+	buf := &bytes.Buffer{}
+	ctx := WithLogger(context.Background(), TextCodec(buf))
+	for i := 0; i < 3; i++ {
+		Log(ctx, "config", Config(m)...)
+	}
+	Sync()
+	t.Log("\n" + buf.String())
+
+	const want = "config, APIKey=[REDACTED], db_password=[REDACTED], debug=false, " +
+		"listen=:8080, session.token=[REDACTED], workers=4"
+	lines := bytes.Split(buf.Bytes(), []byte("\n"))
+	if len(lines) != 4 {
+		t.Fatal("expected 3 lines")
+	}
+	for _, line := range lines[:3] {
+		if !bytes.HasSuffix(line, []byte(want)) {
+			t.Errorf("unexpected output %q", line)
+		}
+		for _, secret := range []string{"hunter2", "abc", "xyz"} {
+			if bytes.Contains(line, []byte(secret)) {
+				t.Errorf("secret %q logged", secret)
+			}
+		}
+	}
+}
+
+func TestConfigKeyBoundaries(t *testing.T) {
+	tests := []struct {
+		key       string
+		sensitive bool
+	}{
+		{"password", true},
+		{"DB_PASSWORD", true},
+		{"apiKey", true},
+		{"APIKey", true},
+		{"api-keys", true},
+		{"oauth.Token", true},
+		{"clientSecretFile", true},
+		{"monkey", false},
+		{"keyboard", false},
+		{"Keyboard_Layout", false},
+		{"tokenizer", false},
+		{"secretary", false},
+		{"turnkey", false},
+	}
+	for _, test := range tests {
+		if got := sensitiveConfigKey(test.key); got != test.sensitive {
+			t.Errorf("sensitiveConfigKey(%q) = %v, want %v", test.key, got, test.sensitive)
+		}
+	}
+}
+
+func TestConfigRedactsNested(t *testing.T) {
+	type credentials struct {
+		User     string
+		Password string
+		Extra    map[string]interface{}
+	}
+	m := map[string]interface{}{
+		"db": map[string]interface{}{
+			"host": "localhost",
+			"auth": map[string]string{"user": "admin", "password": "hunter2"},
+		},
+		"upstream": &credentials{
+			User:     "svc",
+			Password: "abc",
+			Extra:    map[string]interface{}{"apiToken": "xyz", "monkey": "banana"},
+		},
+		"replicas": []credentials{{User: "r1", Password: "def"}},
+		"yaml": map[interface{}]interface{}{
+			"password": "ghi",
+			"server":   map[interface{}]interface{}{"token": "jkl", "port": 8080},
+		},
+	}
+	buf := &bytes.Buffer{}
+	ctx := WithLogger(context.Background(), TextCodec(buf))
+	Log(ctx, "config", Config(m)...)
+	Sync()
+	t.Log("\n" + buf.String())
+
+	out := buf.Bytes()
+	for _, secret := range []string{"hunter2", "abc", "xyz", "def", "ghi", "jkl"} {
+		if bytes.Contains(out, []byte(secret)) {
+			t.Errorf("secret %q logged", secret)
+		}
+	}
+	for _, plain := range []string{"localhost", "admin", "svc", "banana", "r1", "8080"} {
+		if !bytes.Contains(out, []byte(plain)) {
+			t.Errorf("value %q not logged", plain)
+		}
+	}
+	if m["db"].(map[string]interface{})["auth"].(map[string]string)["password"] != "hunter2" {
+		t.Error("config map was modified")
+	}
+}
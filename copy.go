@@ -0,0 +1,105 @@
+// Copyright (c) 2017 Josh Rickmar
+// Use of this source code is governed by an ISC
+// license that can be found in the LICENSE file.
+
+package mill
+
+import (
+	"reflect"
+)
+
+// CopyData returns a deep copy of data which may be retained and read after the
+// original values have been mutated.  This is intended for use by codecs (and
+// other sinks) that hold on to log entry data after encodeDone is called,
+// which would otherwise allow data races with callers of Log.
+//
+// Lazy values are evaluated, and their results are copied.  Values logged using
+// Any are copied using reflection, following pointers,
+// slices, maps, arrays, interfaces, and exported struct fields.  Unexported
+// struct fields are copied shallowly, and channels, functions, and unsafe
+// pointers are shared with the original, so values relying on these may not be
+// fully independent of the original.
+func CopyData(data []Data) []Data {
+	if data == nil {
+		return nil
+	}
+	r := make([]Data, len(data))
+	copy(r, data)
+	for i := range r {
+		if r[i].valueType != ValueTypeAny {
+			continue
+		}
+		if f, ok := r[i].any.(lazyFunc); ok {
+			r[i].any = f()
+		}
+		if r[i].any != nil {
+			v := deepCopy(reflect.ValueOf(r[i].any), make(map[uintptr]reflect.Value))
+			r[i].any = v.Interface()
+		}
+	}
+	return r
+}
+
+func deepCopy(v reflect.Value, seen map[uintptr]reflect.Value) reflect.Value {
+	switch v.Kind() {
+	case reflect.Ptr:
+		if v.IsNil() {
+			return v
+		}
+		if c, ok := seen[v.Pointer()]; ok {
+			return c
+		}
+		c := reflect.New(v.Type().Elem())
+		seen[v.Pointer()] = c
+		c.Elem().Set(deepCopy(v.Elem(), seen))
+		return c
+
+	case reflect.Interface:
+		if v.IsNil() {
+			return v
+		}
+		c := reflect.New(v.Type()).Elem()
+		c.Set(deepCopy(v.Elem(), seen))
+		return c
+
+	case reflect.Slice:
+		if v.IsNil() {
+			return v
+		}
+		c := reflect.MakeSlice(v.Type(), v.Len(), v.Len())
+		for i := 0; i < v.Len(); i++ {
+			c.Index(i).Set(deepCopy(v.Index(i), seen))
+		}
+		return c
+
+	case reflect.Array:
+		c := reflect.New(v.Type()).Elem()
+		for i := 0; i < v.Len(); i++ {
+			c.Index(i).Set(deepCopy(v.Index(i), seen))
+		}
+		return c
+
+	case reflect.Map:
+		if v.IsNil() {
+			return v
+		}
+		c := reflect.MakeMap(v.Type())
+		for _, k := range v.MapKeys() {
+			c.SetMapIndex(k, deepCopy(v.MapIndex(k), seen))
+		}
+		return c
+
+	case reflect.Struct:
+		c := reflect.New(v.Type()).Elem()
+		c.Set(v)
+		for i := 0; i < v.NumField(); i++ {
+			if f := c.Field(i); f.CanSet() {
+				f.Set(deepCopy(v.Field(i), seen))
+			}
+		}
+		return c
+
+	default:
+		return v
+	}
+}
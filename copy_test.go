@@ -0,0 +1,77 @@
+// Copyright (c) 2017 Josh Rickmar
+// Use of this source code is governed by an ISC
+// license that can be found in the LICENSE file.
+
+package mill
+
+import (
+	"reflect"
+	"testing"
+)
+
+type copyTestStruct struct {
+	Name     string
+	Values   []int
+	Children map[string]*copyTestStruct
+	Self     *copyTestStruct
+}
+
+func TestCopyData(t *testing.T) {
+	s := &copyTestStruct{
+		Name:     "root",
+		Values:   []int{1, 2, 3},
+		Children: map[string]*copyTestStruct{"a": {Name: "a"}},
+	}
+	s.Self = s
+	slice := []string{"x", "y"}
+	data := []Data{String("s", "v"), Int64("i", 1), Any("struct", s), Any("slice", slice)}
+
+	copied := CopyData(data)
+	s.Name = "mutated"
+	s.Values[0] = 100
+	s.Children["a"].Name = "mutated"
+	s.Children["b"] = nil
+	slice[0] = "mutated"
+	data[1] = Int64("i", 2)
+
+	if copied[0].String() != "v" || copied[1].Int64() != 1 {
+		t.Errorf("unexpected scalar data %v", copied[:2])
+	}
+	cs := copied[2].any.(*copyTestStruct)
+	want := &copyTestStruct{
+		Name:     "root",
+		Values:   []int{1, 2, 3},
+		Children: map[string]*copyTestStruct{"a": {Name: "a"}},
+	}
+	want.Self = want
+	if cs == s || !reflect.DeepEqual(cs, want) {
+		t.Errorf("copied struct is not independent of the original: %+v", cs)
+	}
+	if cs.Self != cs {
+		t.Error("pointer cycle was not preserved")
+	}
+	if cslice := copied[3].any.([]string); cslice[0] != "x" {
+		t.Errorf("copied slice is not independent of the original: %v", cslice)
+	}
+	if CopyData(nil) != nil {
+		t.Error("copy of nil data is not nil")
+	}
+}
+
+func TestCopyDataResolvesLazy(t *testing.T) {
+	calls := 0
+	values := []int{1, 2}
+	data := []Data{Lazy("lazy", func() interface{} {
+		calls++
+		return values
+	})}
+
+	copied := CopyData(data)
+	if calls != 1 {
+		t.Fatalf("lazy function called %d times by CopyData", calls)
+	}
+	values[0] = 100
+	if v := copied[0].Value(); !reflect.DeepEqual(v, []int{1, 2}) || calls != 1 {
+		t.Errorf("copied lazy value %v was not resolved (%d calls)", v, calls)
+	}
+}
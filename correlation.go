@@ -0,0 +1,59 @@
+// Copyright (c) 2017 Josh Rickmar
+// Use of this source code is governed by an ISC
+// license that can be found in the LICENSE file.
+
+package mill
+
+import (
+	"context"
+	"net/http"
+)
+
+const (
+	// CorrelationHeader is the HTTP header used to propagate correlation IDs.
+	CorrelationHeader = "X-Correlation-ID"
+
+	// CorrelationTag is the log tag key used to record correlation IDs.
+	CorrelationTag = "correlation_id"
+)
+
+// WithCorrelationID creates a copy of the context with the log tag pair
+// correlation_id=id.  All calls to Log and Debug will include this tag pair.
+func WithCorrelationID(ctx context.Context, id string) context.Context {
+	return WithLogTagPair(ctx, CorrelationTag, id)
+}
+
+// CorrelationID returns the most recently added correlation ID of the context,
+// and whether any correlation ID was found.
+func CorrelationID(ctx context.Context) (string, bool) {
+	v := ctx.Value(contextTags{})
+	if v == nil {
+		return "", false
+	}
+	tags := v.([]KV)
+	for i := len(tags) - 1; i >= 0; i-- {
+		if tags[i].Key == CorrelationTag {
+			return tags[i].Value, true
+		}
+	}
+	return "", false
+}
+
+// CorrelationFromHTTP creates a copy of the context tagged with the correlation
+// ID of an incoming HTTP request, read from the CorrelationHeader header.  If
+// the request does not carry a correlation ID, ctx is returned unmodified.
+func CorrelationFromHTTP(ctx context.Context, r *http.Request) context.Context {
+	id := r.Header.Get(CorrelationHeader)
+	if id == "" {
+		return ctx
+	}
+	return WithCorrelationID(ctx, id)
+}
+
+// CorrelationToHTTP sets the CorrelationHeader header of an outgoing HTTP
+// request to the correlation ID of the context, if any.
+func CorrelationToHTTP(ctx context.Context, req *http.Request) {
+	if id, ok := CorrelationID(ctx); ok {
+		req.Header.Set(CorrelationHeader, id)
+	}
+}
@@ -0,0 +1,57 @@
+// Copyright (c) 2017 Josh Rickmar
+// Use of this source code is governed by an ISC
+// license that can be found in the LICENSE file.
+
+package mill
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+func TestCorrelationHTTPRoundTrip(t *testing.T) {
+	c := &recordingCodec{}
+	ctx := WithLogger(context.Background(), c)
+
+	var received string
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		ctx := CorrelationFromHTTP(ctx, r)
+		received, _ = CorrelationID(ctx)
+		Log(ctx, "handled request")
+	}))
+	defer srv.Close()
+
+	req, err := http.NewRequest("GET", srv.URL, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	CorrelationToHTTP(WithCorrelationID(ctx, "abc123"), req)
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		t.Fatal(err)
+	}
+	resp.Body.Close()
+	Sync()
+
+	if received != "abc123" {
+		t.Errorf("received correlation ID %q, expected %q", received, "abc123")
+	}
+	if len(c.entries) != 1 || len(c.entries[0].tags) != 1 ||
+		c.entries[0].tags[0] != (KV{CorrelationTag, "abc123"}) {
+		t.Errorf("unexpected entries %v", c.entries)
+	}
+}
+
+func TestCorrelationMissing(t *testing.T) {
+	ctx := context.Background()
+	req := httptest.NewRequest("GET", "/", nil)
+	if CorrelationFromHTTP(ctx, req) != ctx {
+		t.Error("context modified without correlation ID")
+	}
+	CorrelationToHTTP(ctx, req)
+	if _, ok := req.Header[CorrelationHeader]; ok {
+		t.Error("header set without correlation ID")
+	}
+}
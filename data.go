@@ -5,8 +5,18 @@
 package mill
 
 import (
+	"bytes"
+	"crypto/sha256"
+	"encoding"
+	"encoding/hex"
 	"fmt"
 	"math"
+	"reflect"
+	"sort"
+	"strconv"
+	"strings"
+	"sync/atomic"
+	"time"
 )
 
 // ValueType describes the type of data stored in a Data.
@@ -22,8 +32,11 @@ const (
 	ValueTypeUint64
 	ValueTypeFloat64
 	ValueTypeAny
+	ValueTypeDuration
+	ValueTypeByteSize
+	ValueTypeNull
 
-	valueTypeMaxValue = ValueTypeAny
+	valueTypeMaxValue = ValueTypeNull
 )
 
 // Data describes some additional data being logged.  All data is named so it
@@ -35,9 +48,12 @@ const (
 type Data struct {
 	name      string
 	valueType ValueType
-	string    string
+	string    string // string value, or text suffix of numeric values
 	numBits   uint64
 	any       interface{}
+	debugOnly bool
+	textOmit  bool // omitted by the text codec
+	event     bool // names the event of an entry (see Event)
 }
 
 // String returns a Data recording a string.
@@ -51,6 +67,46 @@ func Error(value error) Data {
 	return String("error", value.Error())
 }
 
+// UUID is a convenience function that returns a String data type describing
+// the canonical 8-4-4-4-12 hyphenated hexadecimal encoding of a UUID.  The raw
+// 16 byte array is accepted to avoid a dependency on any particular UUID
+// package, and no validation of the version or variant is performed.
+func UUID(name string, id [16]byte) Data {
+	var b [36]byte
+	hex.Encode(b[0:8], id[0:4])
+	b[8] = '-'
+	hex.Encode(b[9:13], id[4:6])
+	b[13] = '-'
+	hex.Encode(b[14:18], id[6:8])
+	b[18] = '-'
+	hex.Encode(b[19:23], id[8:10])
+	b[23] = '-'
+	hex.Encode(b[24:36], id[10:16])
+	return String(name, string(b[:]))
+}
+
+// Hashed is a convenience function that returns a String data type describing
+// a hash of a sensitive value, allowing log entries to be correlated by the
+// value without recording it.  The hash is the hex encoding of the first 16
+// bytes of the SHA-256 digest of value.  Only the hash is retained by the
+// returned Data.
+//
+// Note that hashes of values with few possible inputs (such as short numbers)
+// can be reversed by brute force.
+func Hashed(name string, value string) Data {
+	return HashedFunc(name, value, sha256Truncated)
+}
+
+// HashedFunc is like Hashed but hashes value using the provided hash function.
+func HashedFunc(name string, value string, hash func(string) string) Data {
+	return String(name, hash(value))
+}
+
+func sha256Truncated(value string) string {
+	sum := sha256.Sum256([]byte(value))
+	return hex.EncodeToString(sum[:16])
+}
+
 // Int64 returns a Data recording an int64.
 func Int64(name string, value int64) Data {
 	return Data{name: name, valueType: ValueTypeInt64, numBits: uint64(value)}
@@ -66,6 +122,136 @@ func Float64(name string, value float64) Data {
 	return Data{name: name, valueType: ValueTypeFloat64, numBits: math.Float64bits(value)}
 }
 
+// Float64Unit returns a Data recording a float64 measured in some unit (e.g.
+// "MB" or "ms").  Codecs may render the unit alongside the value (e.g. 1.5MB in
+// text) or record it separately.
+func Float64Unit(name string, value float64, unit string) Data {
+	d := Float64(name, value)
+	d.string = unit
+	return d
+}
+
+// Attempt returns data describing an attempt of a retried operation, with the
+// fields attempt, max_attempts, and last_error.  The last_error field is only
+// included when lastErr is non-nil (typically for all but the first attempt).
+// The text codec renders the attempt compactly, e.g. attempt=2/5.
+func Attempt(number, max int, lastErr error) []Data {
+	attempt := Int64("attempt", int64(number))
+	attempt.string = "/" + strconv.Itoa(max)
+	maxAttempts := Int64("max_attempts", int64(max))
+	maxAttempts.textOmit = true
+	if lastErr == nil {
+		return []Data{attempt, maxAttempts}
+	}
+	return []Data{attempt, maxAttempts, String("last_error", lastErr.Error())}
+}
+
+// expectation is the value of an Expect data.
+type expectation struct {
+	want, got interface{}
+	match     bool
+}
+
+// String formats the expectation as want=<want> got=<got> match=<match>, with
+// values formatted by the same rules as the text codec.
+func (e *expectation) String() string {
+	var buf bytes.Buffer
+	buf.WriteString("want=")
+	writeAny(&buf, e.want)
+	buf.WriteString(" got=")
+	writeAny(&buf, e.got)
+	buf.WriteString(" match=")
+	buf.WriteString(strconv.FormatBool(e.match))
+	return buf.String()
+}
+
+// Expect returns a Data recording the expected and actual values of a
+// comparison, such as a test assertion, along with whether they match.  Values
+// match if they are deeply equal (see reflect.DeepEqual).  The JSON codecs
+// encode the value as an object with the keys want, got, and match, and the
+// text codec renders it as want=<want> got=<got> match=<match>.
+func Expect(name string, want, got interface{}) Data {
+	e := &expectation{want: want, got: got, match: reflect.DeepEqual(want, got)}
+	return Any(name, e)
+}
+
+// flags is the value of a Flags data.
+type flags map[string]bool
+
+// String formats the names of the enabled flags in sorted order, e.g. [a, c].
+func (f flags) String() string {
+	enabled := make([]string, 0, len(f))
+	for name, on := range f {
+		if on {
+			enabled = append(enabled, name)
+		}
+	}
+	sort.Strings(enabled)
+	return "[" + strings.Join(enabled, ", ") + "]"
+}
+
+// Flags returns a Data named "flags" recording a set of boolean flags.  The
+// text codec renders only the names of the enabled flags in sorted order (e.g.
+// flags=[a, c], or flags=[] if none are enabled), while the JSON codecs encode
+// the full map.
+func Flags(m map[string]bool) Data {
+	return Any("flags", flags(m))
+}
+
+// geoPoint is the value of a GeoPoint data.
+type geoPoint struct {
+	lat, lon float64
+}
+
+// valid returns whether the latitude and longitude are within range.
+func (p *geoPoint) valid() bool {
+	return p.lat >= -90 && p.lat <= 90 && p.lon >= -180 && p.lon <= 180
+}
+
+// String formats the point as (lat,lon), followed by [invalid] if either
+// coordinate is out of range.
+func (p *geoPoint) String() string {
+	b := []byte{'('}
+	b = strconv.AppendFloat(b, p.lat, 'g', -1, 64)
+	b = append(b, ',')
+	b = strconv.AppendFloat(b, p.lon, 'g', -1, 64)
+	b = append(b, ')')
+	if !p.valid() {
+		b = append(b, "[invalid]"...)
+	}
+	return string(b)
+}
+
+// GeoPoint returns a Data recording a geographic coordinate in degrees.  The
+// text codec renders the point as (lat,lon), and the JSON codecs encode a
+// GeoJSON Point object, {"type":"Point","coordinates":[lon,lat]}, with the
+// longitude first as required by GeoJSON.  Coordinates outside of the valid
+// latitude range of -90 to 90 or longitude range of -180 to 180 are marked
+// invalid, rendered in text with an [invalid] suffix and in JSON with an
+// additional "invalid":true key.
+func GeoPoint(name string, lat, lon float64) Data {
+	return Any(name, &geoPoint{lat: lat, lon: lon})
+}
+
+// Duration returns a Data recording a time.Duration.
+func Duration(name string, value time.Duration) Data {
+	return Data{name: name, valueType: ValueTypeDuration, numBits: uint64(value)}
+}
+
+// ByteSize returns a Data recording a size or count of bytes.  Codecs may
+// render the size in a human-readable form (e.g. 1.0GiB) rather than the raw
+// count.
+func ByteSize(name string, n int64) Data {
+	return Data{name: name, valueType: ValueTypeByteSize, numBits: uint64(n)}
+}
+
+// Null returns a Data recording that a value was checked for and found to be
+// absent.  Unlike omitting the field, the field is encoded, with a null value
+// (e.g. name=null in text and null in JSON).
+func Null(name string) Data {
+	return Data{name: name, valueType: ValueTypeNull}
+}
+
 // Any returns a Data recording any possible value type boxed in an empty
 // interface.  Codecs may treat the value differently depending on the actual
 // type and its interfaces (e.g. calling String if the value is a fmt.Stringer).
@@ -73,12 +259,50 @@ func Any(name string, value interface{}) Data {
 	return Data{name: name, valueType: ValueTypeAny, any: value}
 }
 
+// DebugOnly returns a Data recording any possible value (see Any) that is only
+// encoded by codecs for debug log entries (entries with the "debug" tag, such
+// as those created by Debug).  It is skipped for all other entries, allowing
+// diagnostic values to be included with a single Log call without bloating
+// non-debug output.
+func DebugOnly(name string, value interface{}) Data {
+	d := Any(name, value)
+	d.debugOnly = true
+	return d
+}
+
+type lazyFunc func() interface{}
+
+// Lazy returns a Data recording a value that is computed by calling f only
+// when the value is encoded, and is otherwise treated the same as Any.  This
+// allows expensive values to be logged without paying their cost for entries
+// that are never encoded, such as entries dropped by a sampling codec (see
+// SamplingCodec).
+//
+// f is called once by each codec that encodes the value, and may be called
+// concurrently.  Entries retained after Log returns, such as those buffered by
+// BufferEarly or WithBuffer, or recorded by CaptureCodec, copy their data using
+// CopyData, which calls f before Log returns.
+func Lazy(name string, f func() interface{}) Data {
+	return Data{name: name, valueType: ValueTypeAny, any: lazyFunc(f)}
+}
+
 // Name returns the name of the data field.
 func (d *Data) Name() string { return d.name }
 
 // Type returns the type of data described by the Data.
 func (d *Data) Type() ValueType { return d.valueType }
 
+// IsEvent returns whether the Data records the event name of a log entry
+// created by Event.
+func (d *Data) IsEvent() bool { return d.event }
+
+// IsDebugOnly returns whether the Data should only be encoded for debug log
+// entries.
+func (d *Data) IsDebugOnly() bool { return d.debugOnly }
+
+// IsNull returns whether the Data records an absent value (see Null).
+func (d *Data) IsNull() bool { return d.valueType == ValueTypeNull }
+
 func checkType(have, want ValueType) {
 	if have != want {
 		panic(fmt.Sprintf("value type mismatch: %v != %v", have, want))
@@ -93,6 +317,15 @@ func (d *Data) String() string {
 	return d.string
 }
 
+// Unit returns the unit of a float64 value contained by the Data, or the empty
+// string if no unit was recorded.
+//
+// This function panics if the Data does not describe a float64.
+func (d *Data) Unit() string {
+	checkType(d.valueType, ValueTypeFloat64)
+	return d.string
+}
+
 // Int64 returns the int64 value contained by the Data.
 //
 // This function panics if the Data does not describe an int64.
@@ -117,6 +350,31 @@ func (d *Data) Float64() float64 {
 	return math.Float64frombits(d.numBits)
 }
 
+// Duration returns the time.Duration value contained by the Data.
+//
+// This function panics if the Data does not describe a time.Duration.
+func (d *Data) Duration() time.Duration {
+	checkType(d.valueType, ValueTypeDuration)
+	return time.Duration(d.numBits)
+}
+
+// ByteSize returns the byte size contained by the Data.
+//
+// This function panics if the Data does not describe a byte size.
+func (d *Data) ByteSize() int64 {
+	checkType(d.valueType, ValueTypeByteSize)
+	return int64(d.numBits)
+}
+
+// anyValue returns the value of an Any or Lazy Data, calling the function of a
+// Lazy value.
+func (d *Data) anyValue() interface{} {
+	if f, ok := d.any.(lazyFunc); ok {
+		return f()
+	}
+	return d.any
+}
+
 // Value returns the value contained by the Data, boxed in an empty interface.
 //
 // This function panics if the Data is the invalid zero value.
@@ -133,8 +391,14 @@ func (d *Data) Value() interface{} {
 		return d.numBits
 	case ValueTypeFloat64:
 		return math.Float64frombits(d.numBits)
+	case ValueTypeDuration:
+		return time.Duration(d.numBits)
+	case ValueTypeByteSize:
+		return int64(d.numBits)
+	case ValueTypeNull:
+		return nil
 	case ValueTypeAny:
-		switch v := d.any.(type) {
+		switch v := d.anyValue().(type) {
 		case fmt.Stringer:
 			return v.String()
 		default:
@@ -142,3 +406,50 @@ func (d *Data) Value() interface{} {
 		}
 	}
 }
+
+// hasDebugTag returns whether the tags contain the single "debug" tag.
+func hasDebugTag(tags []KV) bool {
+	for i := range tags {
+		if tags[i].Key == "debug" && tags[i].Value == "" {
+			return true
+		}
+	}
+	return false
+}
+
+var nullEmptyCollections int32 // atomic
+
+// SetNullEmptyCollections sets how codecs render empty slices and maps logged
+// using Any.  By default, nil and empty collections are both rendered as empty
+// collections (e.g. [] and {} in JSON).  When enabled, nil and empty
+// collections are both rendered as null.
+//
+// Collections implementing encoding.TextMarshaler or fmt.Stringer (or a
+// codec-specific marshaling interface, such as json.Marshaler) are not
+// affected.
+func SetNullEmptyCollections(enabled bool) {
+	var v int32
+	if enabled {
+		v = 1
+	}
+	atomic.StoreInt32(&nullEmptyCollections, v)
+}
+
+// emptyCollection reports whether v is a nil or empty slice or map that should
+// be normalized by codecs, and whether it should be rendered as null.
+func emptyCollection(v interface{}) (empty, null bool) {
+	switch v.(type) {
+	case nil, encoding.TextMarshaler, fmt.Stringer:
+		return false, false
+	}
+	rv := reflect.ValueOf(v)
+	switch rv.Kind() {
+	case reflect.Slice, reflect.Map:
+		if rv.Len() != 0 {
+			return false, false
+		}
+	default:
+		return false, false
+	}
+	return true, atomic.LoadInt32(&nullEmptyCollections) != 0
+}
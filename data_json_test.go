@@ -0,0 +1,184 @@
+// Copyright (c) 2017 Josh Rickmar
+// Use of this source code is governed by an ISC
+// license that can be found in the LICENSE file.
+
+//+build !nojson
+
+package mill
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"strings"
+	"testing"
+)
+
+func TestUUIDJSON(t *testing.T) {
+	js := &bytes.Buffer{}
+	ctx := WithLogger(context.Background(), JSONCodec(js))
+	Log(ctx, "message", UUID("id", testUUID.id))
+	Sync()
+
+	var entry jsonSchema
+	if err := json.Unmarshal(js.Bytes(), &entry); err != nil {
+		t.Fatal(err)
+	}
+	if entry.Data["id"] != testUUID.want {
+		t.Errorf("unexpected JSON id %v", entry.Data["id"])
+	}
+}
+
+func TestDebugOnlyJSON(t *testing.T) {
+	js := &bytes.Buffer{}
+	ctx := WithLogger(context.Background(), JSONCodec(js))
+	Log(ctx, "message", String("k", "v"), DebugOnly("state", "dump"))
+	Sync()
+	if bytes.Contains(js.Bytes(), []byte("state")) {
+		t.Errorf("debug only field in JSON output %q", js.Bytes())
+	}
+
+	js.Reset()
+	Log(WithLogTag(ctx, "debug"), "message", String("k", "v"), DebugOnly("state", "dump"))
+	Sync()
+	var entry jsonSchema
+	if err := json.Unmarshal(js.Bytes(), &entry); err != nil {
+		t.Fatal(err)
+	}
+	if entry.Data["state"] != "dump" {
+		t.Errorf("debug only field missing from JSON output %q", js.Bytes())
+	}
+}
+
+func TestFloat64UnitJSON(t *testing.T) {
+	js := &bytes.Buffer{}
+	ctx := WithLogger(context.Background(), JSONCodec(js))
+	Log(ctx, "message", Float64Unit("size", 1.5, "MB"), Float64("ratio", 0.5))
+	Sync()
+
+	var entry struct {
+		Data struct {
+			Size  jsonUnitValue `json:"size"`
+			Ratio float64       `json:"ratio"`
+		} `json:"data"`
+	}
+	if err := json.Unmarshal(js.Bytes(), &entry); err != nil {
+		t.Fatal(err)
+	}
+	if entry.Data.Size != (jsonUnitValue{1.5, "MB"}) || entry.Data.Ratio != 0.5 {
+		t.Errorf("unexpected JSON output %s", js.Bytes())
+	}
+}
+
+func TestEmptyCollectionsJSON(t *testing.T) {
+	defer SetNullEmptyCollections(false)
+
+	js := logEmptyCollections(JSONCodec)
+	if !bytes.Contains(js, []byte(`"data":{"emptymap":{},"emptyslice":[],"nilmap":{},"nilslice":[],"slice":[1]}`)) {
+		t.Errorf("unexpected JSON output %s", js)
+	}
+
+	SetNullEmptyCollections(true)
+	js = logEmptyCollections(JSONCodec)
+	if !bytes.Contains(js, []byte(`"data":{"emptymap":null,"emptyslice":null,"nilmap":null,"nilslice":null,"slice":[1]}`)) {
+		t.Errorf("unexpected JSON output %s", js)
+	}
+}
+
+func TestAttemptJSON(t *testing.T) {
+	js := &bytes.Buffer{}
+	ctx := WithLogger(context.Background(), JSONCodec(js))
+
+	Log(ctx, "retrying", Attempt(1, 5, nil)...)
+	Sync()
+	if !bytes.Contains(js.Bytes(), []byte(`"data":{"attempt":1,"max_attempts":5}`)) {
+		t.Errorf("unexpected JSON output %s", js.Bytes())
+	}
+
+	js.Reset()
+	Log(ctx, "retrying", Attempt(2, 5, errors.New("timeout"))...)
+	Sync()
+	if !bytes.Contains(js.Bytes(), []byte(`"data":{"attempt":2,"last_error":"timeout","max_attempts":5}`)) {
+		t.Errorf("unexpected JSON output %s", js.Bytes())
+	}
+}
+
+func TestHashedJSON(t *testing.T) {
+	const email = "alice@example.com"
+	js := &bytes.Buffer{}
+	ctx := WithLogger(context.Background(), JSONCodec(js))
+	Log(ctx, "message", Hashed("user", email))
+	Sync()
+
+	if bytes.Contains(js.Bytes(), []byte(email)) {
+		t.Errorf("plaintext in output %q", js.Bytes())
+	}
+	hashed := Hashed("user", email)
+	if !strings.Contains(js.String(), `"user":"`+hashed.String()+`"`) {
+		t.Errorf("unexpected JSON output %s", js.Bytes())
+	}
+}
+
+func TestExpectJSON(t *testing.T) {
+	js := &bytes.Buffer{}
+	ctx := WithLogger(context.Background(), JSONCodec(js))
+
+	Log(ctx, "check", Expect("sum", 3, 3), Expect("names", []string{"a"}, []string{"a", "b"}))
+	Sync()
+	want := `"data":{"names":{"want":["a"],"got":["a","b"],"match":false},"sum":{"want":3,"got":3,"match":true}}`
+	if !bytes.Contains(js.Bytes(), []byte(want)) {
+		t.Errorf("unexpected JSON output %s", js.Bytes())
+	}
+}
+
+func TestNullJSON(t *testing.T) {
+	js := &bytes.Buffer{}
+	ctx := WithLogger(context.Background(), JSONCodec(js))
+
+	Log(ctx, "checked", Null("parent"))
+	Log(ctx, "unchecked")
+	Sync()
+	var checked, unchecked struct {
+		Data map[string]interface{} `json:"data"`
+	}
+	dec := json.NewDecoder(js)
+	if err := dec.Decode(&checked); err != nil {
+		t.Fatal(err)
+	}
+	if err := dec.Decode(&unchecked); err != nil {
+		t.Fatal(err)
+	}
+	if v, ok := checked.Data["parent"]; !ok || v != nil {
+		t.Errorf("unexpected JSON output %v", checked.Data)
+	}
+	if unchecked.Data != nil {
+		t.Errorf("unexpected JSON output %v", unchecked.Data)
+	}
+}
+
+func TestFlagsJSON(t *testing.T) {
+	for _, test := range flagsTests {
+		js := &bytes.Buffer{}
+		ctx := WithLogger(context.Background(), JSONCodec(js))
+		Log(ctx, "message", Flags(test.flags))
+		Sync()
+
+		if !bytes.Contains(js.Bytes(), []byte(`"data":{"flags":`+test.json+`}`)) {
+			t.Errorf("unexpected JSON output %s", js.Bytes())
+		}
+	}
+}
+
+func TestGeoPointJSON(t *testing.T) {
+	for _, test := range geoPointTests {
+		js := &bytes.Buffer{}
+		ctx := WithLogger(context.Background(), JSONCodec(js))
+		Log(ctx, "message", GeoPoint("loc", test.lat, test.lon))
+		Sync()
+
+		if !bytes.Contains(js.Bytes(), []byte(`"data":{"loc":`+test.json+`}`)) {
+			t.Errorf("unexpected JSON output %s", js.Bytes())
+		}
+	}
+}
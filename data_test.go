@@ -0,0 +1,225 @@
+// Copyright (c) 2017 Josh Rickmar
+// Use of this source code is governed by an ISC
+// license that can be found in the LICENSE file.
+
+package mill
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"io"
+	"math"
+	"strings"
+	"testing"
+)
+
+// testUUID is a UUID and its canonical string form.
+var testUUID = struct {
+	id   [16]byte
+	want string
+}{
+	[16]byte{
+		0x12, 0x3e, 0x45, 0x67, 0xe8, 0x9b, 0x12, 0xd3,
+		0xa4, 0x56, 0x42, 0x66, 0x14, 0x17, 0x40, 0x00,
+	},
+	"123e4567-e89b-12d3-a456-426614174000",
+}
+
+func TestUUID(t *testing.T) {
+	text := &bytes.Buffer{}
+	ctx := WithLogger(context.Background(), TextCodec(text))
+	Log(ctx, "message", UUID("id", testUUID.id))
+	Sync()
+
+	if !bytes.HasSuffix(text.Bytes(), []byte("message, id="+testUUID.want+"\n")) {
+		t.Errorf("unexpected text output %q", text.Bytes())
+	}
+}
+
+func TestDebugOnly(t *testing.T) {
+	text := &bytes.Buffer{}
+	ctx := WithLogger(context.Background(), TextCodec(text))
+	Log(ctx, "message", String("k", "v"), DebugOnly("state", "dump"))
+	Sync()
+	if bytes.Contains(text.Bytes(), []byte("state")) {
+		t.Errorf("debug only field in text output %q", text.Bytes())
+	}
+
+	text.Reset()
+	Log(WithLogTag(ctx, "debug"), "message", String("k", "v"), DebugOnly("state", "dump"))
+	Sync()
+	if !bytes.HasSuffix(text.Bytes(), []byte("message, k=v, state=dump\n")) {
+		t.Errorf("debug only field missing from text output %q", text.Bytes())
+	}
+}
+
+func TestFloat64Unit(t *testing.T) {
+	text := &bytes.Buffer{}
+	ctx := WithLogger(context.Background(), TextCodec(text))
+	Log(ctx, "message", Float64Unit("size", 1.5, "MB"), Float64("ratio", 0.5))
+	Sync()
+
+	if !bytes.HasSuffix(text.Bytes(), []byte("message, size=1.5MB, ratio=0.5\n")) {
+		t.Errorf("unexpected text output %q", text.Bytes())
+	}
+}
+
+// logEmptyCollections logs nil and empty collections to a codec created by
+// newCodec, returning the output.
+func logEmptyCollections(newCodec func(w io.Writer) Codec) []byte {
+	buf := &bytes.Buffer{}
+	ctx := WithLogger(context.Background(), newCodec(buf))
+	var nilSlice []int
+	var nilMap map[string]int
+	Log(ctx, "message",
+		Any("nilslice", nilSlice), Any("emptyslice", []int{}),
+		Any("nilmap", nilMap), Any("emptymap", map[string]int{}),
+		Any("slice", []int{1}))
+	Sync()
+	return buf.Bytes()
+}
+
+func TestEmptyCollections(t *testing.T) {
+	defer SetNullEmptyCollections(false)
+
+	text := logEmptyCollections(TextCodec)
+	if !bytes.HasSuffix(text, []byte("message, nilslice=[], emptyslice=[], nilmap=map[], emptymap=map[], slice=[1]\n")) {
+		t.Errorf("unexpected text output %q", text)
+	}
+
+	SetNullEmptyCollections(true)
+	text = logEmptyCollections(TextCodec)
+	if !bytes.HasSuffix(text, []byte("message, nilslice=null, emptyslice=null, nilmap=null, emptymap=null, slice=[1]\n")) {
+		t.Errorf("unexpected text output %q", text)
+	}
+}
+
+func TestAttempt(t *testing.T) {
+	text := &bytes.Buffer{}
+	ctx := WithLogger(context.Background(), TextCodec(text))
+
+	Log(ctx, "retrying", Attempt(1, 5, nil)...)
+	Sync()
+	if !bytes.HasSuffix(text.Bytes(), []byte("retrying, attempt=1/5\n")) {
+		t.Errorf("unexpected text output %q", text.Bytes())
+	}
+
+	text.Reset()
+	Log(ctx, "retrying", Attempt(2, 5, errors.New("timeout"))...)
+	Sync()
+	if !bytes.HasSuffix(text.Bytes(), []byte("retrying, attempt=2/5, last_error=timeout\n")) {
+		t.Errorf("unexpected text output %q", text.Bytes())
+	}
+}
+
+func TestHashed(t *testing.T) {
+	const email = "alice@example.com"
+	text := &bytes.Buffer{}
+	ctx := WithLogger(context.Background(), TextCodec(text))
+	Log(ctx, "message", Hashed("user", email), Hashed("user2", email), Hashed("other", "bob@example.com"))
+	Sync()
+
+	if bytes.Contains(text.Bytes(), []byte(email)) {
+		t.Errorf("plaintext in output %q", text.Bytes())
+	}
+	a, b, c := Hashed("user", email), Hashed("user", email), Hashed("user", "bob@example.com")
+	if a.String() != b.String() {
+		t.Error("identical inputs hashed differently")
+	}
+	if a.String() == c.String() {
+		t.Error("different inputs hashed identically")
+	}
+	if len(a.String()) != 32 {
+		t.Errorf("unexpected hash length %d", len(a.String()))
+	}
+	if !bytes.Contains(text.Bytes(), []byte("user="+a.String()+", user2="+a.String())) {
+		t.Errorf("unexpected text output %q", text.Bytes())
+	}
+
+	upper := HashedFunc("user", email, strings.ToUpper)
+	if upper.String() != strings.ToUpper(email) {
+		t.Errorf("custom hash function not used: %q", upper.String())
+	}
+}
+
+func TestExpect(t *testing.T) {
+	text := &bytes.Buffer{}
+	ctx := WithLogger(context.Background(), TextCodec(text))
+
+	Log(ctx, "check", Expect("sum", 3, 3), Expect("names", []string{"a"}, []string{"a", "b"}))
+	Sync()
+	if !bytes.HasSuffix(text.Bytes(), []byte("check, sum=want=3 got=3 match=true, names=want=[a] got=[a b] match=false\n")) {
+		t.Errorf("unexpected text output %q", text.Bytes())
+	}
+}
+
+func TestNull(t *testing.T) {
+	text := &bytes.Buffer{}
+	ctx := WithLogger(context.Background(), TextCodec(text))
+
+	d := Null("parent")
+	if !d.IsNull() || d.Value() != nil {
+		t.Errorf("unexpected null data %v %v", d.IsNull(), d.Value())
+	}
+	if s := String("parent", ""); s.IsNull() {
+		t.Error("empty string is null")
+	}
+
+	Log(ctx, "checked", Null("parent"))
+	Log(ctx, "unchecked")
+	Sync()
+	lines := bytes.Split(text.Bytes(), []byte("\n"))
+	if !bytes.HasSuffix(lines[0], []byte("checked, parent=null")) ||
+		!bytes.HasSuffix(lines[1], []byte("unchecked")) {
+		t.Errorf("unexpected text output %q", text.Bytes())
+	}
+}
+
+// flagsTests are the flags encoded by TestFlags and TestFlagsJSON.
+var flagsTests = []struct {
+	flags      map[string]bool
+	text, json string
+}{
+	{map[string]bool{"c": true, "b": false, "a": true}, "flags=[a, c]", `{"a":true,"b":false,"c":true}`},
+	{map[string]bool{"a": false, "b": false}, "flags=[]", `{"a":false,"b":false}`},
+	{nil, "flags=[]", `null`},
+}
+
+func TestFlags(t *testing.T) {
+	for _, test := range flagsTests {
+		text := &bytes.Buffer{}
+		ctx := WithLogger(context.Background(), TextCodec(text))
+		Log(ctx, "message", Flags(test.flags))
+		Sync()
+
+		if !bytes.HasSuffix(text.Bytes(), []byte("message, "+test.text+"\n")) {
+			t.Errorf("unexpected text output %q", text.Bytes())
+		}
+	}
+}
+
+// geoPointTests are the points encoded by TestGeoPoint and TestGeoPointJSON.
+var geoPointTests = []struct {
+	lat, lon   float64
+	text, json string
+}{
+	{51.5, -0.12, "(51.5,-0.12)", `{"type":"Point","coordinates":[-0.12,51.5]}`},
+	{-90, 180, "(-90,180)", `{"type":"Point","coordinates":[180,-90]}`},
+	{91, 10, "(91,10)[invalid]", `{"type":"Point","coordinates":[10,91],"invalid":true}`},
+	{0, -180.5, "(0,-180.5)[invalid]", `{"type":"Point","coordinates":[-180.5,0],"invalid":true}`},
+	{math.NaN(), 0, "(NaN,0)[invalid]", `{"type":"Point","coordinates":null,"invalid":true}`},
+}
+
+func TestGeoPoint(t *testing.T) {
+	for _, test := range geoPointTests {
+		text := &bytes.Buffer{}
+		ctx := WithLogger(context.Background(), TextCodec(text))
+		Log(ctx, "message", GeoPoint("loc", test.lat, test.lon))
+		Sync()
+
+		if !bytes.HasSuffix(text.Bytes(), []byte("message, loc="+test.text+"\n")) {
+			t.Errorf("unexpected text output %q", text.Bytes())
+		}
+	}
+}
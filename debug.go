@@ -40,6 +40,35 @@ func setGlobalDebuggingEnabled(enabled bool) {
 	globalDebugging.setEnabled(enabled)
 }
 
+var componentDebugging struct {
+	enabled map[string]bool
+	mu      sync.Mutex
+}
+
+func setComponentDebugEnabled(component string, enabled bool) {
+	componentDebugging.mu.Lock()
+	if enabled {
+		if componentDebugging.enabled == nil {
+			componentDebugging.enabled = make(map[string]bool)
+		}
+		componentDebugging.enabled[component] = true
+	} else {
+		delete(componentDebugging.enabled, component)
+	}
+	componentDebugging.mu.Unlock()
+}
+
+func componentDebugEnabled(ctx context.Context) bool {
+	component := contextComponent(ctx)
+	if component == "" {
+		return false
+	}
+	componentDebugging.mu.Lock()
+	enabled := componentDebugging.enabled[component]
+	componentDebugging.mu.Unlock()
+	return enabled
+}
+
 func withDebuggingInitialized(ctx context.Context) context.Context {
 	if ctx.Value(debugKey{}) != nil {
 		return ctx
@@ -61,7 +90,7 @@ func debuggingEnabled(ctx context.Context) bool {
 }
 
 func debug(ctx context.Context, message string, data ...Data) {
-	if globalDebugging.isEnabled() || debuggingEnabled(ctx) {
+	if globalDebugging.isEnabled() || debuggingEnabled(ctx) || componentDebugEnabled(ctx) {
 		Log(WithLogTag(ctx, "debug"), message, data...)
 	}
 }
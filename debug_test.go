@@ -0,0 +1,44 @@
+// Copyright (c) 2017 Josh Rickmar
+// Use of this source code is governed by an ISC
+// license that can be found in the LICENSE file.
+
+//+build !release
+
+package mill
+
+import (
+	"bytes"
+	"context"
+	"testing"
+)
+
+func TestComponentDebug(t *testing.T) {
+	SetComponentDebugEnabled("storage", true)
+	defer SetComponentDebugEnabled("storage", false)
+
+	buf := &bytes.Buffer{}
+	ctx := WithLogger(context.Background(), TextCodec(buf))
+	storage := WithComponent(ctx, "storage")
+	network := WithComponent(ctx, "network")
+	Debug(storage, "storage debug")
+	Debug(network, "network debug")
+	Debug(ctx, "no component debug")
+	Debug(WithComponent(storage, "cache"), "nested component debug")
+	Log(network, "network log")
+	Sync()
+
+	lines := bytes.Split(buf.Bytes(), []byte("\n"))
+	if len(lines) != 3 ||
+		!bytes.HasSuffix(lines[0], []byte("[component=storage, debug] storage debug")) ||
+		!bytes.HasSuffix(lines[1], []byte("[component=network] network log")) {
+		t.Errorf("unexpected output %q", buf.Bytes())
+	}
+
+	SetComponentDebugEnabled("storage", false)
+	buf.Reset()
+	Debug(storage, "disabled storage debug")
+	Sync()
+	if buf.Len() != 0 {
+		t.Errorf("unexpected output %q", buf.Bytes())
+	}
+}
@@ -0,0 +1,94 @@
+// Copyright (c) 2017 Josh Rickmar
+// Use of this source code is governed by an ISC
+// license that can be found in the LICENSE file.
+
+package mill
+
+import (
+	"errors"
+	"io"
+	"os"
+	"sync"
+)
+
+// ErrWriterDegraded is returned by writes to a degraded DegradingWriter.
+var ErrWriterDegraded = errors.New("mill: writer is degraded after being closed")
+
+// DegradingWriter is a writer for codecs that stops writing to an underlying
+// writer once it has been closed, such as a log file closed during shutdown
+// while entries are still being logged.
+type DegradingWriter struct {
+	writer   io.Writer
+	report   func(error)
+	degraded bool
+	mu       sync.Mutex
+}
+
+// DegradeOnClose creates a DegradingWriter writing to w.  Once a write to w
+// fails because w was closed (os.ErrClosed or io.ErrClosedPipe), the writer is
+// marked degraded, report is called once with the error (if report is not
+// nil), and all later writes fail with ErrWriterDegraded without being
+// attempted.  Other write errors are returned without degrading the writer.
+// Writes resume once a new writer is provided by Swap.
+func DegradeOnClose(w io.Writer, report func(error)) *DegradingWriter {
+	return &DegradingWriter{writer: w, report: report}
+}
+
+func isClosedError(err error) bool {
+	if pe, ok := err.(*os.PathError); ok {
+		err = pe.Err
+	}
+	return err == os.ErrClosed || err == io.ErrClosedPipe
+}
+
+// Write implements the io.Writer interface.  The report function is called
+// without holding the lock of the writer, so it may use the writer itself.
+func (w *DegradingWriter) Write(p []byte) (n int, err error) {
+	w.mu.Lock()
+	if w.degraded {
+		w.mu.Unlock()
+		return 0, ErrWriterDegraded
+	}
+	n, err = w.writer.Write(p)
+	degraded := err != nil && isClosedError(err)
+	if degraded {
+		w.degraded = true
+	}
+	report := w.report
+	w.mu.Unlock()
+
+	if degraded && report != nil {
+		report(err)
+	}
+	return n, err
+}
+
+// Flush flushes the underlying writer if it implements Flusher and the writer
+// is not degraded.
+func (w *DegradingWriter) Flush() error {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	if w.degraded {
+		return ErrWriterDegraded
+	}
+	if f, ok := w.writer.(Flusher); ok {
+		return f.Flush()
+	}
+	return nil
+}
+
+// Swap replaces the underlying writer with nw and recovers a degraded writer.
+// Entries written after Swap returns are written to nw.
+func (w *DegradingWriter) Swap(nw io.Writer) {
+	w.mu.Lock()
+	w.writer = nw
+	w.degraded = false
+	w.mu.Unlock()
+}
+
+// Degraded returns whether the writer is degraded.
+func (w *DegradingWriter) Degraded() bool {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	return w.degraded
+}
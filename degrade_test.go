@@ -0,0 +1,88 @@
+// Copyright (c) 2017 Josh Rickmar
+// Use of this source code is governed by an ISC
+// license that can be found in the LICENSE file.
+
+package mill
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"os"
+	"testing"
+	"time"
+)
+
+func TestDegradeOnClose(t *testing.T) {
+	f, err := ioutil.TempFile("", "mill")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.Remove(f.Name())
+
+	var reports []error
+	w := DegradeOnClose(f, func(err error) { reports = append(reports, err) })
+	ctx := WithLogger(context.Background(), TextCodec(w))
+	Log(ctx, "written")
+	Sync()
+	f.Close()
+	for i := 0; i < 10; i++ {
+		Log(ctx, "dropped")
+	}
+	Sync()
+
+	if len(reports) != 1 || !isClosedError(reports[0]) {
+		t.Fatalf("unexpected degradation reports %v", reports)
+	}
+	if !w.Degraded() {
+		t.Error("writer not degraded")
+	}
+	if err := FlushCodec(TextCodec(w)); err != ErrWriterDegraded {
+		t.Errorf("unexpected flush error %v", err)
+	}
+	contents, err := ioutil.ReadFile(f.Name())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.HasSuffix(contents, []byte("written\n")) || bytes.Contains(contents, []byte("dropped")) {
+		t.Errorf("unexpected file contents %q", contents)
+	}
+
+	buf := &bytes.Buffer{}
+	w.Swap(buf)
+	Log(ctx, "recovered")
+	Sync()
+	if w.Degraded() || !bytes.HasSuffix(buf.Bytes(), []byte("recovered\n")) {
+		t.Errorf("writer did not recover: %q", buf.Bytes())
+	}
+	if len(reports) != 1 {
+		t.Errorf("unexpected degradation reports %v", reports)
+	}
+}
+
+func TestDegradeOnCloseReportUsesWriter(t *testing.T) {
+	_, pw := io.Pipe()
+	pw.Close()
+	buf := &bytes.Buffer{}
+	var w *DegradingWriter
+	w = DegradeOnClose(pw, func(err error) {
+		w.Swap(buf)
+		fmt.Fprintf(w, "degraded: %v\n", err)
+	})
+
+	written := make(chan struct{})
+	go func() {
+		w.Write([]byte("entry\n"))
+		close(written)
+	}()
+	select {
+	case <-written:
+	case <-time.After(5 * time.Second):
+		t.Fatal("report deadlocked using the writer")
+	}
+	if buf.String() != "degraded: "+io.ErrClosedPipe.Error()+"\n" {
+		t.Errorf("unexpected output %q", buf.String())
+	}
+}
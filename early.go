@@ -0,0 +1,91 @@
+// Copyright (c) 2017 Josh Rickmar
+// Use of this source code is governed by an ISC
+// license that can be found in the LICENSE file.
+
+package mill
+
+import (
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+type earlyEntry struct {
+	format  Format
+	t       time.Time
+	tags    []KV
+	message string
+	data    []Data
+}
+
+var earlyLog struct {
+	enabled int32 // atomic
+	max     int
+	entries []earlyEntry
+	dropped uint64
+	mu      sync.Mutex
+}
+
+// BufferEarly begins buffering log entries that are logged using contexts
+// without any attached loggers, such as those logged during package
+// initialization before any codec has been configured.  Buffered entries are
+// written once ReplayEarly is called.
+//
+// At most max entries are buffered.  Later entries are dropped and are only
+// reported by count when replayed.
+func BufferEarly(max int) {
+	earlyLog.mu.Lock()
+	earlyLog.max = max
+	atomic.StoreInt32(&earlyLog.enabled, 1)
+	earlyLog.mu.Unlock()
+}
+
+// ReplayEarly stops buffering early log entries (see BufferEarly) and writes
+// all buffered entries to c, in order and with their original timestamps.
+// Global interceptors (see AddGlobalInterceptor) are run on each entry as it is
+// replayed.  If any entries were dropped, an additional entry reporting the
+// number of dropped entries is written.
+func ReplayEarly(c Codec) {
+	earlyLog.mu.Lock()
+	atomic.StoreInt32(&earlyLog.enabled, 0)
+	entries, dropped := earlyLog.entries, earlyLog.dropped
+	earlyLog.entries, earlyLog.dropped = nil, 0
+	earlyLog.mu.Unlock()
+
+	loggers := []Codec{c}
+	for _, e := range entries {
+		tags, message, data := intercept(e.tags, e.message, e.data)
+		logEntry(loggers, e.format, e.t, tags, message, data)
+	}
+	if dropped != 0 {
+		logEntry(loggers, FormatText, time.Time{}, nil, "dropped early log entries", []Data{Uint64("dropped", dropped)})
+	}
+}
+
+// bufferEarlyEntry buffers an entry if early entries are being buffered.  If t
+// is the zero time, the entry is timestamped with the current time.
+func bufferEarlyEntry(format Format, t time.Time, tags []KV, message string, data []Data) {
+	if atomic.LoadInt32(&earlyLog.enabled) == 0 {
+		return
+	}
+
+	if t.IsZero() {
+		t = time.Now()
+	}
+	earlyLog.mu.Lock()
+	defer earlyLog.mu.Unlock()
+	if earlyLog.enabled == 0 {
+		return
+	}
+	if len(earlyLog.entries) >= earlyLog.max {
+		earlyLog.dropped++
+		return
+	}
+	earlyLog.entries = append(earlyLog.entries, earlyEntry{
+		format:  format,
+		t:       t,
+		tags:    tags,
+		message: message,
+		data:    CopyData(data),
+	})
+}
@@ -0,0 +1,60 @@
+// Copyright (c) 2017 Josh Rickmar
+// Use of this source code is governed by an ISC
+// license that can be found in the LICENSE file.
+
+package mill
+
+import (
+	"context"
+	"testing"
+)
+
+func TestBufferEarly(t *testing.T) {
+	BufferEarly(2)
+	ctx := WithLogTag(context.Background(), "init")
+	i := &intStringer{1}
+	Log(ctx, "message 1", Any("i", i))
+	i.i++
+	Log(ctx, "message 2")
+	Log(ctx, "message 3")
+
+	c := &recordingCodec{}
+	ReplayEarly(c)
+	Log(context.Background(), "not buffered")
+	Sync()
+
+	if len(c.entries) != 3 {
+		t.Fatalf("expected 3 entries, got %d", len(c.entries))
+	}
+	if e := c.entries[0]; e.message != "message 1" || e.data[0].Value() != "1" {
+		t.Errorf("unexpected first entry %q %v", e.message, e.data)
+	}
+	if e := c.entries[1]; e.message != "message 2" || len(e.tags) != 1 || e.tags[0].Key != "init" {
+		t.Errorf("unexpected second entry %q %v", e.message, e.tags)
+	}
+	if c.entries[0].t.IsZero() || c.entries[1].t.Before(c.entries[0].t) {
+		t.Error("original timestamps were not preserved")
+	}
+	if e := c.entries[2]; e.message != "dropped early log entries" || e.data[0].Uint64() != 1 {
+		t.Errorf("unexpected drop report %q %v", e.message, e.data)
+	}
+}
+
+func TestReplayEarlyIntercepts(t *testing.T) {
+	defer func(funcs []func(*MutableEntry)) {
+		globalInterceptors.funcs = funcs
+	}(globalInterceptors.funcs)
+
+	BufferEarly(10)
+	Log(context.Background(), "early")
+	AddGlobalInterceptor(func(e *MutableEntry) {
+		e.Message += "!"
+	})
+	c := &recordingCodec{}
+	ReplayEarly(c)
+	Sync()
+
+	if len(c.entries) != 1 || c.entries[0].message != "early!" {
+		t.Errorf("replayed entry was not intercepted: %v", c.entries)
+	}
+}
@@ -0,0 +1,105 @@
+// Copyright (c) 2017 Josh Rickmar
+// Use of this source code is governed by an ISC
+// license that can be found in the LICENSE file.
+
+package mill
+
+import (
+	"context"
+	"io"
+	"time"
+)
+
+// Format describes an output format of a format-switching codec (see
+// FormatCodec).
+type Format uint
+
+// Output formats.  FormatLogfmt writes one line of space separated key=value
+// pairs per entry, beginning with the time, tags (comma separated, if any),
+// and msg keys, followed by all data.  Values are quoted when they are empty
+// or contain spaces, quotes, equals signs, or control characters.
+const (
+	FormatText Format = iota
+	FormatJSON
+	FormatLogfmt
+)
+
+// formatConstructors maps formats to the constructors of their codecs.  Formats
+// of codecs excluded by build tags are not present.
+var formatConstructors = map[Format]func(io.Writer) Codec{
+	FormatText:   TextCodec,
+	FormatLogfmt: newLogfmtCodec,
+}
+
+type formatCodec struct {
+	codecs map[Format]Codec
+}
+
+// FormatCodec creates a Codec that writes each log entry to w in the format
+// selected by the context the entry was logged with (see WithFormat).  Entries
+// are newline terminated in all formats.  Entries are written as text (see
+// TextCodec) if no format was selected, if the selected format is not
+// available due to build tags, or if the codec is wrapped by another codec
+// (other than by IndependentCodec).
+func FormatCodec(w io.Writer) Codec {
+	c := &formatCodec{codecs: make(map[Format]Codec, len(formatConstructors))}
+	for f, newCodec := range formatConstructors {
+		c.codecs[f] = newCodec(w)
+	}
+	return c
+}
+
+func (c *formatCodec) encoder(f Format) Codec {
+	if codec, ok := c.codecs[f]; ok {
+		return codec
+	}
+	return c.codecs[FormatText]
+}
+
+func (c *formatCodec) EncodeLogEntry(t time.Time, tags []KV, message string, data []Data, encodeDone func(), writeReady <-chan struct{}) {
+	c.codecs[FormatText].EncodeLogEntry(t, tags, message, data, encodeDone, writeReady)
+}
+
+// Flush flushes the codec of every format which implements Flusher, returning
+// the first error.
+func (c *formatCodec) Flush() error {
+	var err error
+	for _, codec := range c.codecs {
+		if f, ok := codec.(Flusher); ok {
+			if e := f.Flush(); e != nil && err == nil {
+				err = e
+			}
+		}
+	}
+	return err
+}
+
+// encodeLogEntry encodes a log entry with c, using format if c is a
+// format-switching codec.
+func encodeLogEntry(c Codec, format Format, t time.Time, tags []KV, message string, data []Data, encodeDone func(), writeReady <-chan struct{}) {
+	if ic, ok := c.(*independentCodec); ok {
+		c = ic.Codec
+	}
+	if fc, ok := c.(*formatCodec); ok {
+		c = fc.encoder(format)
+	}
+	c.EncodeLogEntry(t, tags, message, data, encodeDone, writeReady)
+}
+
+type formatKey struct{}
+
+// WithFormat creates a copy of the context which selects the output format of
+// all format-switching codecs (see FormatCodec) that entries logged with the
+// context are written to.  The format is read when each entry is encoded,
+// allowing a single codec to be shared between contexts that require
+// different formats.  Other codecs are unaffected.
+func WithFormat(ctx context.Context, f Format) context.Context {
+	return context.WithValue(ctx, formatKey{}, f)
+}
+
+// contextFormat returns the format selected by the context, or FormatText if
+// none was selected.
+func contextFormat(ctx context.Context) Format {
+	f, _ := ctx.Value(formatKey{}).(Format)
+	return f
+}
@@ -0,0 +1,73 @@
+// Copyright (c) 2017 Josh Rickmar
+// Use of this source code is governed by an ISC
+// license that can be found in the LICENSE file.
+
+//+build !nojson
+
+package mill
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"encoding/json"
+	"testing"
+)
+
+func TestWithFormat(t *testing.T) {
+	buf := &bytes.Buffer{}
+	fc := FormatCodec(buf)
+	ctx := WithLogger(context.Background(), fc)
+	tenantA := WithFormat(ctx, FormatJSON)
+	tenantB := WithFormat(ctx, FormatLogfmt)
+	tenantC := WithLogger(WithFormat(context.Background(), FormatJSON), IndependentCodec(FormatCodec(buf)))
+
+	Log(ctx, "default")
+	LogTo(tenantA, func(c Codec) bool { return c == fc }, "tenant a")
+	Log(tenantB, "tenant b")
+	Log(tenantC, "tenant c")
+	LogBatch(tenantB, EntrySnapshot{Message: "batch 1"}, EntrySnapshot{Message: "batch 2"})
+	Sync()
+	if err := FlushCodec(fc); err != nil {
+		t.Fatal(err)
+	}
+	t.Log("\n" + buf.String())
+
+	lines := bytes.SplitAfter(buf.Bytes(), []byte("\n"))
+	if len(lines) != 7 || len(lines[6]) != 0 {
+		t.Fatal("expected 6 lines")
+	}
+	if !bytes.HasSuffix(lines[0], []byte("[] default\n")) {
+		t.Errorf("unexpected text output %q", lines[0])
+	}
+	var entry jsonSchema
+	if err := json.Unmarshal(lines[1], &entry); err != nil || entry.Message != "tenant a" {
+		t.Errorf("unexpected JSON output %q", lines[1])
+	}
+	if !bytes.HasSuffix(lines[2], []byte(`msg="tenant b"`+"\n")) {
+		t.Errorf("unexpected logfmt output %q", lines[2])
+	}
+	if err := json.Unmarshal(lines[3], &entry); err != nil || entry.Message != "tenant c" {
+		t.Errorf("unexpected JSON output %q", lines[3])
+	}
+	for i, msg := range []string{"batch 1", "batch 2"} {
+		if !bytes.HasSuffix(lines[4+i], []byte(`msg="`+msg+`"`+"\n")) {
+			t.Errorf("unexpected logfmt output %q", lines[4+i])
+		}
+	}
+}
+
+func TestFormatCodecFlush(t *testing.T) {
+	var out bytes.Buffer
+	bw := bufio.NewWriter(&out)
+	fc := FormatCodec(bw)
+	ctx := WithFormat(WithLogger(context.Background(), fc), FormatJSON)
+	Log(ctx, "message")
+	if err := FlushCodec(fc); err != nil {
+		t.Fatal(err)
+	}
+	var entry map[string]interface{}
+	if err := json.Unmarshal(out.Bytes(), &entry); err != nil {
+		t.Fatalf("buffered writer was not flushed: %q: %v", out.Bytes(), err)
+	}
+}
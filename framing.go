@@ -0,0 +1,61 @@
+// Copyright (c) 2017 Josh Rickmar
+// Use of this source code is governed by an ISC
+// license that can be found in the LICENSE file.
+
+package mill
+
+import (
+	"io"
+	"sync"
+)
+
+type framingWriter struct {
+	writer         io.Writer
+	prefix, suffix []byte
+	buf            []byte
+	mu             sync.Mutex
+}
+
+func (w *framingWriter) Write(p []byte) (n int, err error) {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	w.buf = append(w.buf[:0], w.prefix...)
+	w.buf = append(w.buf, p...)
+	w.buf = append(w.buf, w.suffix...)
+	_, err = w.writer.Write(w.buf)
+	if err != nil {
+		return 0, err
+	}
+	return len(p), nil
+}
+
+// Flush flushes the underlying writer if it implements Flusher.
+func (w *framingWriter) Flush() error {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	if f, ok := w.writer.(Flusher); ok {
+		return f.Flush()
+	}
+	return nil
+}
+
+// FramingCodec creates a Codec that wraps every record written by the codec
+// created by newCodec with prefix and suffix framing bytes before writing the
+// framed record to w.  For example, RFC 7464 JSON text sequences can be written
+// using:
+//
+//	mill.FramingCodec(w, []byte{0x1e}, []byte{'\n'}, mill.JSONCodec)
+//
+// The inner codec is created with a writer that frames each call to Write,
+// and therefore it must write each encoded record using a single Write, as
+// all codecs provided by this package do.  Framed records are written to w
+// using a single Write as well.  The framing writer implements Flusher by
+// flushing w if it also implements Flusher, so FlushCodec reaches w through
+// inner codecs which flush their writer.
+//
+// FramingCodec takes a constructor rather than an existing inner codec since
+// a Codec writes directly to the writer it was created with, leaving no way
+// to frame the records of an already created codec.
+func FramingCodec(w io.Writer, prefix, suffix []byte, newCodec func(io.Writer) Codec) Codec {
+	return newCodec(&framingWriter{writer: w, prefix: prefix, suffix: suffix})
+}
@@ -0,0 +1,60 @@
+// Copyright (c) 2017 Josh Rickmar
+// Use of this source code is governed by an ISC
+// license that can be found in the LICENSE file.
+
+//+build !nojson
+
+package mill
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"encoding/json"
+	"testing"
+)
+
+func TestFramingCodecRFC7464(t *testing.T) {
+	buf := &bytes.Buffer{}
+	ctx := WithLogger(context.Background(), FramingCodec(buf, []byte{0x1e}, []byte{'\n'}, JSONCodec))
+	for i := 0; i < 3; i++ {
+		Log(ctx, "message", Int64("i", int64(i)))
+	}
+	Sync()
+	t.Logf("%q", buf.Bytes())
+
+	if buf.Len() == 0 || buf.Bytes()[0] != 0x1e {
+		t.Fatal("output does not begin with record separator")
+	}
+	records := bytes.Split(buf.Bytes()[1:], []byte{0x1e})
+	if len(records) != 3 {
+		t.Fatalf("expected 3 records, got %d", len(records))
+	}
+	for i, r := range records {
+		if !bytes.HasSuffix(r, []byte{'\n'}) {
+			t.Errorf("record %d is not newline terminated", i)
+		}
+		var entry jsonSchema
+		if err := json.Unmarshal(r, &entry); err != nil {
+			t.Errorf("record %d: %v", i, err)
+			continue
+		}
+		if entry.Data["i"] != float64(i) {
+			t.Errorf("record %d out of order: %v", i, entry.Data["i"])
+		}
+	}
+}
+
+func TestFramingCodecFlush(t *testing.T) {
+	var out bytes.Buffer
+	bw := bufio.NewWriter(&out)
+	c := FramingCodec(bw, []byte{0x1e}, []byte{'\n'}, JSONCodec)
+	ctx := WithLogger(context.Background(), c)
+	Log(ctx, "message")
+	if err := FlushCodec(c); err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.HasPrefix(out.Bytes(), []byte{0x1e}) || !bytes.HasSuffix(out.Bytes(), []byte{'\n'}) {
+		t.Errorf("buffered writer was not flushed: %q", out.Bytes())
+	}
+}
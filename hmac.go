@@ -0,0 +1,154 @@
+// Copyright (c) 2017 Josh Rickmar
+// Use of this source code is governed by an ISC
+// license that can be found in the LICENSE file.
+
+package mill
+
+import (
+	"bufio"
+	"bytes"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"hash"
+	"io"
+	"sync"
+)
+
+type hmacWriter struct {
+	writer io.Writer
+	mac    hash.Hash
+	prev   []byte
+	buf    []byte
+	mu     sync.Mutex
+}
+
+// chainMAC computes the MAC of a record chained with the MAC of the previous
+// record.
+func chainMAC(mac hash.Hash, prev, record []byte) []byte {
+	mac.Reset()
+	mac.Write(prev)
+	mac.Write(record)
+	return mac.Sum(nil)
+}
+
+func (w *hmacWriter) Write(p []byte) (n int, err error) {
+	record := bytes.TrimSuffix(p, []byte{'\n'})
+
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	sum := chainMAC(w.mac, w.prev, record)
+	w.buf = append(w.buf[:0], record...)
+	w.buf = append(w.buf, '\t')
+	w.buf = append(w.buf, hex.EncodeToString(sum)...)
+	w.buf = append(w.buf, '\n')
+	_, err = w.writer.Write(w.buf)
+	if err != nil {
+		return 0, err
+	}
+	// The chain only advances once the record has been written, so a failed
+	// write does not break the chain of later records.
+	w.prev = sum
+	return len(p), nil
+}
+
+// HMACCodec creates a Codec that makes the log written to w tamper-evident.
+// Every record written by the codec created by newCodec is followed by a tab
+// and the hex encoded HMAC-SHA256, using key, of the record chained with the
+// HMAC of the previous record.  Since records are written in the order entries
+// are logged, the chain follows the order of the log, and the modification,
+// insertion, removal, or reordering of any record is detected by
+// VerifyHMACChain.  Removal of records from the end of the log can not be
+// detected.
+//
+// As with FramingCodec, the inner codec is created by newCodec rather than
+// passed in, since the records of an existing codec can not be intercepted, and
+// it must write each encoded record using a single Write.  Records must be
+// written on a single line, and any terminating newline is not included in the
+// HMAC.  The text codec writes messages and values containing newlines
+// unescaped, and should only be used if they are not logged.
+//
+// The codec starts a new chain.  Appending to an existing log with HMACCodec
+// causes verification of the whole log to fail at the first appended record;
+// use ResumeHMACCodec to continue the chain of the log instead.
+func HMACCodec(w io.Writer, key []byte, newCodec func(io.Writer) Codec) Codec {
+	return ResumeHMACCodec(w, key, nil, newCodec)
+}
+
+// ResumeHMACCodec creates a Codec like HMACCodec which continues a chain from
+// prev, the HMAC of the last record of an existing log (see LastHMAC), so that
+// records appended to the log are verified together with the existing records.
+// A nil prev starts a new chain.
+func ResumeHMACCodec(w io.Writer, key, prev []byte, newCodec func(io.Writer) Codec) Codec {
+	prev = append([]byte(nil), prev...)
+	return newCodec(&hmacWriter{writer: w, mac: hmac.New(sha256.New, key), prev: prev})
+}
+
+// HMACChainError describes the first line of a log which failed verification
+// by VerifyHMACChain.
+type HMACChainError struct {
+	Line int
+}
+
+func (e *HMACChainError) Error() string {
+	return fmt.Sprintf("mill: HMAC chain verification failed at line %d", e.Line)
+}
+
+// LastHMAC returns the HMAC of the last record of a log written by HMACCodec,
+// or nil if the log is empty.  The chain is not verified.  An *HMACChainError
+// is returned if the last line is malformed, and any error reading r is
+// returned unchanged.
+func LastHMAC(r io.Reader) ([]byte, error) {
+	var last []byte
+	lines := 0
+	s := bufio.NewScanner(r)
+	s.Buffer(nil, 1<<24)
+	for s.Scan() {
+		last = append(last[:0], s.Bytes()...)
+		lines++
+	}
+	if err := s.Err(); err != nil {
+		return nil, err
+	}
+	if lines == 0 {
+		return nil, nil
+	}
+	i := bytes.LastIndexByte(last, '\t')
+	if i == -1 {
+		return nil, &HMACChainError{Line: lines}
+	}
+	sum, err := hex.DecodeString(string(last[i+1:]))
+	if err != nil {
+		return nil, &HMACChainError{Line: lines}
+	}
+	return sum, nil
+}
+
+// VerifyHMACChain verifies the chain of HMACs of a log written by HMACCodec
+// using key.  An *HMACChainError is returned describing the first line that is
+// malformed or does not match its HMAC, and any error reading r is returned
+// unchanged.
+func VerifyHMACChain(r io.Reader, key []byte) error {
+	mac := hmac.New(sha256.New, key)
+	var prev []byte
+	s := bufio.NewScanner(r)
+	s.Buffer(nil, 1<<24)
+	for line := 1; s.Scan(); line++ {
+		b := s.Bytes()
+		i := bytes.LastIndexByte(b, '\t')
+		if i == -1 {
+			return &HMACChainError{Line: line}
+		}
+		want, err := hex.DecodeString(string(b[i+1:]))
+		if err != nil {
+			return &HMACChainError{Line: line}
+		}
+		sum := chainMAC(mac, prev, b[:i])
+		if !hmac.Equal(sum, want) {
+			return &HMACChainError{Line: line}
+		}
+		prev = sum
+	}
+	return s.Err()
+}
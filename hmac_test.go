@@ -0,0 +1,82 @@
+// Copyright (c) 2017 Josh Rickmar
+// Use of this source code is governed by an ISC
+// license that can be found in the LICENSE file.
+
+package mill
+
+import (
+	"bytes"
+	"context"
+	"testing"
+)
+
+func TestHMACCodec(t *testing.T) {
+	key := []byte("secret")
+	buf := &bytes.Buffer{}
+	ctx := WithLogger(context.Background(), HMACCodec(buf, key, TextCodec))
+	for i := 0; i < 5; i++ {
+		Log(ctx, "audit", Int64("i", int64(i)))
+	}
+	Sync()
+	t.Log("\n" + buf.String())
+	log := buf.Bytes()
+
+	if err := VerifyHMACChain(bytes.NewReader(log), key); err != nil {
+		t.Fatalf("valid log failed verification: %v", err)
+	}
+	if err := VerifyHMACChain(bytes.NewReader(log), []byte("wrong")); err == nil {
+		t.Error("log verified with the wrong key")
+	}
+
+	lines := bytes.SplitAfter(log, []byte("\n"))
+	tests := []struct {
+		name     string
+		tampered [][]byte
+		line     int
+	}{
+		{"modified", [][]byte{lines[0], lines[1], bytes.Replace(lines[2], []byte("i=2"), []byte("i=9"), 1), lines[3], lines[4]}, 3},
+		{"removed", [][]byte{lines[0], lines[1], lines[3], lines[4]}, 3},
+		{"reordered", [][]byte{lines[0], lines[2], lines[1], lines[3], lines[4]}, 2},
+		{"truncated MAC", [][]byte{lines[0], lines[1][:len(lines[1])-3], lines[2]}, 2},
+	}
+	for _, test := range tests {
+		err := VerifyHMACChain(bytes.NewReader(bytes.Join(test.tampered, nil)), key)
+		e, ok := err.(*HMACChainError)
+		if !ok || e.Line != test.line {
+			t.Errorf("%s: unexpected error %v, want failure at line %d", test.name, err, test.line)
+		}
+	}
+}
+
+func TestResumeHMACCodec(t *testing.T) {
+	key := []byte("secret")
+	buf := &bytes.Buffer{}
+	ctx := WithLogger(context.Background(), HMACCodec(buf, key, TextCodec))
+	Log(ctx, "first run")
+	Sync()
+
+	// A new codec appending to the log continues its chain.
+	prev, err := LastHMAC(bytes.NewReader(buf.Bytes()))
+	if err != nil {
+		t.Fatal(err)
+	}
+	ctx = WithLogger(context.Background(), ResumeHMACCodec(buf, key, prev, TextCodec))
+	Log(ctx, "second run")
+	Sync()
+	if err := VerifyHMACChain(bytes.NewReader(buf.Bytes()), key); err != nil {
+		t.Errorf("resumed log failed verification: %v", err)
+	}
+
+	// Starting a new chain breaks verification at the appended record.
+	ctx = WithLogger(context.Background(), HMACCodec(buf, key, TextCodec))
+	Log(ctx, "third run")
+	Sync()
+	err = VerifyHMACChain(bytes.NewReader(buf.Bytes()), key)
+	if e, ok := err.(*HMACChainError); !ok || e.Line != 3 {
+		t.Errorf("unexpected error %v, want failure at line 3", err)
+	}
+
+	if prev, err := LastHMAC(bytes.NewReader(nil)); prev != nil || err != nil {
+		t.Errorf("empty log: unexpected HMAC %x, error %v", prev, err)
+	}
+}
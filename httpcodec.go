@@ -0,0 +1,250 @@
+// Copyright (c) 2017 Josh Rickmar
+// Use of this source code is governed by an ISC
+// license that can be found in the LICENSE file.
+
+//+build !nojson
+
+package mill
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"sync"
+	"time"
+)
+
+// HTTPCodecOptions describes the batching and delivery behavior of an HTTP
+// codec.  Zero values are replaced with defaults.
+type HTTPCodecOptions struct {
+	// Client is the HTTP client used to POST batches.  Defaults to
+	// http.DefaultClient.
+	Client *http.Client
+
+	// APIKey, if non-empty, is sent with every request in the header named
+	// by APIKeyHeader (default "Authorization").
+	APIKey       string
+	APIKeyHeader string
+
+	// BatchSize is the number of entries that triggers a POST of the batch.
+	// Defaults to 100.
+	BatchSize int
+
+	// FlushInterval is the interval at which any partial batch is POSTed.
+	// Defaults to 5 seconds.
+	FlushInterval time.Duration
+
+	// MaxRetries is the number of times a failed POST is retried before the
+	// batch is discarded.  Only network errors and 5xx responses are retried.
+	// Defaults to 3, and a negative value disables retries.
+	MaxRetries int
+
+	// RetryBackoff is the delay before the first retry, and is doubled for
+	// every following retry.  Defaults to 100 milliseconds.
+	RetryBackoff time.Duration
+}
+
+// HTTPBatcher is a Codec that encodes log entries as JSON objects (using the
+// same schema as JSONCodec) and POSTs them in batches, as a JSON array, to an
+// HTTP endpoint.
+type HTTPBatcher struct {
+	endpoint string
+	opts     HTTPCodecOptions
+
+	batch  [][]byte
+	closed bool
+	mu     sync.Mutex
+
+	full    chan struct{}
+	flushes chan chan error
+	quit    chan struct{}
+	done    chan struct{}
+	closing sync.Once
+}
+
+// HTTPCodec creates an HTTPBatcher which POSTs batches of JSON encoded log
+// entries to endpoint.  Batches are sent whenever the batch size is reached or
+// the flush interval elapses.
+//
+// Sync flushes the batcher, delivering all entries logged up to now.  Flush
+// may be called instead to observe delivery errors.  Close must be called to
+// deliver any final batch and release the background goroutine.
+func HTTPCodec(endpoint string, opts HTTPCodecOptions) *HTTPBatcher {
+	if opts.Client == nil {
+		opts.Client = http.DefaultClient
+	}
+	if opts.APIKeyHeader == "" {
+		opts.APIKeyHeader = "Authorization"
+	}
+	if opts.BatchSize <= 0 {
+		opts.BatchSize = 100
+	}
+	if opts.FlushInterval <= 0 {
+		opts.FlushInterval = 5 * time.Second
+	}
+	if opts.MaxRetries < 0 {
+		opts.MaxRetries = 0
+	} else if opts.MaxRetries == 0 {
+		opts.MaxRetries = 3
+	}
+	if opts.RetryBackoff <= 0 {
+		opts.RetryBackoff = 100 * time.Millisecond
+	}
+	c := &HTTPBatcher{
+		endpoint: endpoint,
+		opts:     opts,
+		full:     make(chan struct{}, 1),
+		flushes:  make(chan chan error),
+		quit:     make(chan struct{}),
+		done:     make(chan struct{}),
+	}
+	go c.run()
+	FlushOnSync(c, true)
+	return c
+}
+
+// EncodeLogEntry implements the Codec interface.
+func (c *HTTPBatcher) EncodeLogEntry(t time.Time, tags []KV, message string, data []Data, encodeDone func(), writeReady <-chan struct{}) {
+	b, err := encodeJSON(t, tags, message, data, jsonDataNested)
+	encodeDone()
+	<-writeReady
+	if err != nil {
+		return
+	}
+
+	c.mu.Lock()
+	if c.closed {
+		c.mu.Unlock()
+		return
+	}
+	c.batch = append(c.batch, b)
+	full := len(c.batch) >= c.opts.BatchSize
+	c.mu.Unlock()
+	if full {
+		select {
+		case c.full <- struct{}{}:
+		default:
+		}
+	}
+}
+
+func (c *HTTPBatcher) run() {
+	ticker := time.NewTicker(c.opts.FlushInterval)
+	defer ticker.Stop()
+	defer close(c.done)
+	for {
+		select {
+		case <-ticker.C:
+			c.send()
+		case <-c.full:
+			c.send()
+		case errc := <-c.flushes:
+			errc <- c.send()
+		case <-c.quit:
+			return
+		}
+	}
+}
+
+// ErrHTTPBatcherClosed is returned when flushing a closed HTTPBatcher.
+var ErrHTTPBatcherClosed = errors.New("mill: HTTP batcher is closed")
+
+// Flush POSTs all pending entries, returning the first error if any batch could
+// not be delivered.
+func (c *HTTPBatcher) Flush() error {
+	errc := make(chan error, 1)
+	select {
+	case c.flushes <- errc:
+		return <-errc
+	case <-c.done:
+		return ErrHTTPBatcherClosed
+	}
+}
+
+// Close waits for all entries logged before Close to be written, flushes them,
+// and stops the background sender.  Entries written after Close are dropped.
+func (c *HTTPBatcher) Close() error {
+	err := ErrHTTPBatcherClosed
+	c.closing.Do(func() {
+		FlushOnSync(c, false)
+		Sync()
+		c.mu.Lock()
+		c.closed = true
+		c.mu.Unlock()
+		err = c.Flush()
+		close(c.quit)
+		<-c.done
+	})
+	return err
+}
+
+// send POSTs all pending entries, split into batches of at most BatchSize
+// entries.  It must only be called by the run goroutine.
+func (c *HTTPBatcher) send() error {
+	c.mu.Lock()
+	pending := c.batch
+	c.batch = nil
+	c.mu.Unlock()
+
+	var err error
+	for len(pending) != 0 {
+		n := len(pending)
+		if n > c.opts.BatchSize {
+			n = c.opts.BatchSize
+		}
+		if e := c.sendBatch(pending[:n]); e != nil && err == nil {
+			err = e
+		}
+		pending = pending[n:]
+	}
+	return err
+}
+
+// sendBatch POSTs a single batch, retrying with exponential backoff on failure.
+func (c *HTTPBatcher) sendBatch(batch [][]byte) error {
+	var body bytes.Buffer
+	body.WriteByte('[')
+	for i, b := range batch {
+		if i != 0 {
+			body.WriteByte(',')
+		}
+		body.Write(b)
+	}
+	body.WriteByte(']')
+
+	backoff := c.opts.RetryBackoff
+	for attempt := 0; ; attempt++ {
+		retry, err := c.post(body.Bytes())
+		if err == nil || !retry || attempt == c.opts.MaxRetries {
+			return err
+		}
+		time.Sleep(backoff)
+		backoff *= 2
+	}
+}
+
+func (c *HTTPBatcher) post(body []byte) (retry bool, err error) {
+	req, err := http.NewRequest("POST", c.endpoint, bytes.NewReader(body))
+	if err != nil {
+		return false, err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	if c.opts.APIKey != "" {
+		req.Header.Set(c.opts.APIKeyHeader, c.opts.APIKey)
+	}
+	resp, err := c.opts.Client.Do(req)
+	if err != nil {
+		return true, err
+	}
+	// Drain the body so the connection can be reused.
+	io.Copy(ioutil.Discard, resp.Body)
+	resp.Body.Close()
+	if resp.StatusCode/100 != 2 {
+		err = fmt.Errorf("mill: HTTP batch POST failed: %s", resp.Status)
+		return resp.StatusCode >= 500, err
+	}
+	return false, nil
+}
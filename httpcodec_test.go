@@ -0,0 +1,207 @@
+// Copyright (c) 2017 Josh Rickmar
+// Use of this source code is governed by an ISC
+// license that can be found in the LICENSE file.
+
+//+build !nojson
+
+package mill
+
+import (
+	"context"
+	"encoding/json"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"testing"
+	"time"
+)
+
+type batchRecorder struct {
+	batches [][]jsonSchema
+	keys    []string
+	fail    int
+	mu      sync.Mutex
+}
+
+func (r *batchRecorder) ServeHTTP(w http.ResponseWriter, req *http.Request) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.keys = append(r.keys, req.Header.Get("X-API-Key"))
+	if r.fail > 0 {
+		r.fail--
+		w.WriteHeader(http.StatusServiceUnavailable)
+		return
+	}
+	body, _ := ioutil.ReadAll(req.Body)
+	var batch []jsonSchema
+	if err := json.Unmarshal(body, &batch); err != nil {
+		w.WriteHeader(http.StatusBadRequest)
+		return
+	}
+	r.batches = append(r.batches, batch)
+}
+
+func TestHTTPCodecBatches(t *testing.T) {
+	rec := &batchRecorder{}
+	srv := httptest.NewServer(rec)
+	defer srv.Close()
+
+	c := HTTPCodec(srv.URL, HTTPCodecOptions{
+		APIKey:        "secret",
+		APIKeyHeader:  "X-API-Key",
+		BatchSize:     2,
+		FlushInterval: time.Hour,
+	})
+	ctx := WithLogger(context.Background(), c)
+	for i := 0; i < 5; i++ {
+		Log(ctx, "message", Int64("i", int64(i)))
+	}
+	Sync()
+	if err := c.Close(); err != nil {
+		t.Fatal(err)
+	}
+
+	rec.mu.Lock()
+	defer rec.mu.Unlock()
+	var n int
+	for _, batch := range rec.batches {
+		if len(batch) > 2 {
+			t.Errorf("batch of %d entries exceeds batch size", len(batch))
+		}
+		for _, e := range batch {
+			if i := e.Data["i"].(float64); int(i) != n {
+				t.Errorf("entry %d out of order: %v", n, i)
+			}
+			n++
+		}
+	}
+	if n != 5 {
+		t.Errorf("expected 5 delivered entries, got %d", n)
+	}
+	for _, key := range rec.keys {
+		if key != "secret" {
+			t.Errorf("unexpected API key header %q", key)
+		}
+	}
+}
+
+func TestHTTPCodecRetries(t *testing.T) {
+	rec := &batchRecorder{fail: 2}
+	srv := httptest.NewServer(rec)
+	defer srv.Close()
+
+	c := HTTPCodec(srv.URL, HTTPCodecOptions{
+		FlushInterval: time.Hour,
+		RetryBackoff:  time.Millisecond,
+	})
+	defer c.Close()
+	ctx := WithLogger(context.Background(), c)
+	Log(ctx, "message")
+	Sync()
+	if err := c.Flush(); err != nil {
+		t.Fatal(err)
+	}
+
+	rec.mu.Lock()
+	defer rec.mu.Unlock()
+	if len(rec.keys) != 3 {
+		t.Errorf("expected 3 attempts, got %d", len(rec.keys))
+	}
+	if len(rec.batches) != 1 || len(rec.batches[0]) != 1 {
+		t.Errorf("expected single delivered batch, got %v", rec.batches)
+	}
+}
+
+func TestHTTPCodecGivesUp(t *testing.T) {
+	rec := &batchRecorder{fail: 10}
+	srv := httptest.NewServer(rec)
+	defer srv.Close()
+
+	c := HTTPCodec(srv.URL, HTTPCodecOptions{
+		FlushInterval: time.Hour,
+		MaxRetries:    1,
+		RetryBackoff:  time.Millisecond,
+	})
+	defer c.Close()
+	ctx := WithLogger(context.Background(), c)
+	Log(ctx, "message")
+	waitWrites() // Sync would flush the batch, discarding the error
+	if err := c.Flush(); err == nil {
+		t.Fatal("expected error after exhausting retries")
+	}
+	if len(rec.keys) != 2 {
+		t.Errorf("expected 2 attempts, got %d", len(rec.keys))
+	}
+}
+
+func TestHTTPCodecSyncFlushes(t *testing.T) {
+	rec := &batchRecorder{}
+	srv := httptest.NewServer(rec)
+	defer srv.Close()
+
+	c := HTTPCodec(srv.URL, HTTPCodecOptions{FlushInterval: time.Hour})
+	defer c.Close()
+	ctx := WithLogger(context.Background(), c)
+	Log(ctx, "message")
+	Sync()
+
+	rec.mu.Lock()
+	defer rec.mu.Unlock()
+	if len(rec.batches) != 1 || len(rec.batches[0]) != 1 {
+		t.Errorf("expected entry delivered by Sync, got %v", rec.batches)
+	}
+}
+
+func TestHTTPCodecCloseWaitsForSlowSibling(t *testing.T) {
+	rec := &batchRecorder{}
+	srv := httptest.NewServer(rec)
+	defer srv.Close()
+
+	c := HTTPCodec(srv.URL, HTTPCodecOptions{FlushInterval: time.Hour})
+	ctx := WithLogger(context.Background(), TextCodec(slowWriter{50 * time.Millisecond}))
+	ctx = WithLogger(ctx, c)
+	Log(ctx, "m1")
+	Log(ctx, "m2")
+	if err := c.Close(); err != nil {
+		t.Fatal(err)
+	}
+
+	rec.mu.Lock()
+	defer rec.mu.Unlock()
+	var messages []string
+	for _, batch := range rec.batches {
+		for _, e := range batch {
+			messages = append(messages, e.Message)
+		}
+	}
+	if len(messages) != 2 || messages[0] != "m1" || messages[1] != "m2" {
+		t.Errorf("unexpected delivered messages %v", messages)
+	}
+}
+
+func TestHTTPCodecDropsAfterClose(t *testing.T) {
+	rec := &batchRecorder{}
+	srv := httptest.NewServer(rec)
+	defer srv.Close()
+
+	c := HTTPCodec(srv.URL, HTTPCodecOptions{FlushInterval: time.Hour})
+	if err := c.Close(); err != nil {
+		t.Fatal(err)
+	}
+	ctx := WithLogger(context.Background(), c)
+	for i := 0; i < 10; i++ {
+		Log(ctx, "message")
+	}
+	Sync()
+
+	c.mu.Lock()
+	pending := len(c.batch)
+	c.mu.Unlock()
+	if pending != 0 {
+		t.Errorf("%d entries buffered after Close", pending)
+	}
+	if err := c.Flush(); err != ErrHTTPBatcherClosed {
+		t.Errorf("unexpected Flush error %v", err)
+	}
+}
@@ -0,0 +1,59 @@
+// Copyright (c) 2017 Josh Rickmar
+// Use of this source code is governed by an ISC
+// license that can be found in the LICENSE file.
+
+package mill
+
+import (
+	"sync"
+)
+
+// MutableEntry describes a log entry which may be modified by an interceptor
+// before it is encoded.  The Tags and Data slices are copies owned by the entry
+// and may be modified in place or replaced.
+type MutableEntry struct {
+	Message string
+	Tags    []KV
+	Data    []Data
+}
+
+var globalInterceptors struct {
+	funcs []func(*MutableEntry)
+	mu    sync.Mutex
+}
+
+// AddGlobalInterceptor registers a function to observe and modify every log
+// entry logged to any context with attached loggers, and every early entry
+// replayed by ReplayEarly.  Interceptors are called
+// synchronously by Log, in the order they were registered, before the entry is
+// encoded by any codec.
+//
+// Interceptors may be called concurrently and must be safe for concurrent use.
+func AddGlobalInterceptor(f func(*MutableEntry)) {
+	globalInterceptors.mu.Lock()
+	funcs := make([]func(*MutableEntry), len(globalInterceptors.funcs), len(globalInterceptors.funcs)+1)
+	copy(funcs, globalInterceptors.funcs)
+	globalInterceptors.funcs = append(funcs, f)
+	globalInterceptors.mu.Unlock()
+}
+
+// intercept runs all global interceptors on a log entry, returning the
+// possibly modified message, tags, and data.
+func intercept(tags []KV, message string, data []Data) ([]KV, string, []Data) {
+	globalInterceptors.mu.Lock()
+	funcs := globalInterceptors.funcs
+	globalInterceptors.mu.Unlock()
+	if len(funcs) == 0 {
+		return tags, message, data
+	}
+
+	e := &MutableEntry{
+		Message: message,
+		Tags:    append([]KV(nil), tags...),
+		Data:    append([]Data(nil), data...),
+	}
+	for _, f := range funcs {
+		f(e)
+	}
+	return e.Tags, e.Message, e.Data
+}
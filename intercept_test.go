@@ -0,0 +1,55 @@
+// Copyright (c) 2017 Josh Rickmar
+// Use of this source code is governed by an ISC
+// license that can be found in the LICENSE file.
+
+package mill
+
+import (
+	"context"
+	"testing"
+)
+
+func TestGlobalInterceptor(t *testing.T) {
+	defer func(funcs []func(*MutableEntry)) {
+		globalInterceptors.funcs = funcs
+	}(globalInterceptors.funcs)
+
+	var n int64
+	AddGlobalInterceptor(func(e *MutableEntry) {
+		e.Tags = append(e.Tags, KV{"host", "example"})
+	})
+	AddGlobalInterceptor(func(e *MutableEntry) {
+		n++
+		e.Message = e.Message + "!"
+		e.Data = append(e.Data, Int64("seq", n))
+	})
+
+	ca, cb := &recordingCodec{}, &recordingCodec{}
+	ctxA := WithLogger(context.Background(), ca)
+	ctxB := WithLogTag(WithLogger(context.Background(), cb), "b")
+	data := []Data{String("k", "v")}
+	Log(ctxA, "message a", data...)
+	Log(ctxB, "message b", data...)
+	Sync()
+
+	if len(data) != 1 || data[0].Name() != "k" {
+		t.Error("caller's data slice was modified")
+	}
+	check := func(c *recordingCodec, message string, ntags int, seq int64) {
+		if len(c.entries) != 1 {
+			t.Fatalf("expected 1 entry, got %d", len(c.entries))
+		}
+		e := c.entries[0]
+		if e.message != message {
+			t.Errorf("unexpected message %q, expected %q", e.message, message)
+		}
+		if len(e.tags) != ntags || e.tags[ntags-1] != (KV{"host", "example"}) {
+			t.Errorf("unexpected tags %v", e.tags)
+		}
+		if len(e.data) != 2 || e.data[1].Int64() != seq {
+			t.Errorf("unexpected data %v", e.data)
+		}
+	}
+	check(ca, "message a!", 1, 1)
+	check(cb, "message b!", 2, 2)
+}
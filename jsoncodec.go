@@ -2,17 +2,33 @@
 // Use of this source code is governed by an ISC
 // license that can be found in the LICENSE file.
 
+//+build !nojson
+
 package mill
 
 import (
 	"encoding/json"
 	"fmt"
 	"io"
+	"math"
+	"reflect"
+	"strings"
+	"sync"
 	"time"
 )
 
+// jsonDataLayout describes how data fields are laid out in JSON objects.
+type jsonDataLayout int
+
+const (
+	jsonDataNested   jsonDataLayout = iota // under the "data" key
+	jsonDataFlat                           // promoted to top-level keys
+	jsonDataExpanded                       // under "data", expanding dotted names
+)
+
 type jsonCodec struct {
 	writer io.Writer
+	layout jsonDataLayout
 }
 
 type jsonSchema struct {
@@ -20,6 +36,7 @@ type jsonSchema struct {
 	DateUnix    int64                  `json:"dateunix"`
 	NanoSeconds int64                  `json:"nanoseconds"`
 	Tags        []string               `json:"tags,omitempty"`
+	Event       string                 `json:"event,omitempty"`
 	Message     string                 `json:"message"`
 	Data        map[string]interface{} `json:"data,omitempty"`
 }
@@ -35,15 +52,140 @@ func (kv *jsonKV) MarshalJSON() ([]byte, error) {
 	return json.Marshal(fmt.Sprintf("%s=%s", kv.k, kv.v))
 }
 
+type jsonUnitValue struct {
+	Value float64 `json:"value"`
+	Unit  string  `json:"unit"`
+}
+
+// jsonValue returns the value of d to be encoded as JSON.
+func jsonValue(d *Data) interface{} {
+	if d.valueType == ValueTypeFloat64 && d.string != "" {
+		return jsonUnitValue{Value: d.Float64(), Unit: d.string}
+	}
+	if d.valueType == ValueTypeAny {
+		v := d.anyValue()
+		switch v.(type) {
+		case *expectation, flags, *geoPoint:
+			// Encoded as JSON objects rather than their strings.
+			return v
+		}
+		if _, ok := v.(json.Marshaler); !ok {
+			if empty, null := emptyCollection(v); empty {
+				switch {
+				case null:
+					return nil
+				case reflect.ValueOf(v).Kind() == reflect.Map:
+					return struct{}{}
+				default:
+					return [0]struct{}{}
+				}
+			}
+		}
+		if s, ok := v.(fmt.Stringer); ok {
+			return s.String()
+		}
+		return v
+	}
+	return d.Value()
+}
+
+// MarshalJSON implements the json.Marshaler interface.
+func (e *expectation) MarshalJSON() ([]byte, error) {
+	want, got := Any("", e.want), Any("", e.got)
+	return json.Marshal(struct {
+		Want  interface{} `json:"want"`
+		Got   interface{} `json:"got"`
+		Match bool        `json:"match"`
+	}{jsonValue(&want), jsonValue(&got), e.match})
+}
+
+// MarshalJSON implements the json.Marshaler interface.
+func (f flags) MarshalJSON() ([]byte, error) {
+	return json.Marshal(map[string]bool(f))
+}
+
+// MarshalJSON implements the json.Marshaler interface.
+func (p *geoPoint) MarshalJSON() ([]byte, error) {
+	// Non-finite coordinates can not be encoded as JSON numbers.
+	var coordinates []float64
+	if sum := p.lat + p.lon; !math.IsNaN(sum) && !math.IsInf(sum, 0) {
+		coordinates = []float64{p.lon, p.lat}
+	}
+	return json.Marshal(struct {
+		Type        string    `json:"type"`
+		Coordinates []float64 `json:"coordinates"`
+		Invalid     bool      `json:"invalid,omitempty"`
+	}{"Point", coordinates, !p.valid()})
+}
+
 type jsonDataObject struct {
 	Name  string      `json:"name"`
 	Value interface{} `json:"value"`
 }
 
 // JSONCodec creates a Codec that writes encoded log entries as JSON objects to
-// w.
+// w.  Each entry is written with a single Write and is not terminated; use
+// FramingCodec to delimit entries, e.g. with newlines.
 func JSONCodec(w io.Writer) Codec {
-	return &jsonCodec{w}
+	return &jsonCodec{writer: w}
+}
+
+// JSONCodecFlatData creates a Codec that writes encoded log entries as JSON
+// objects to w, with each data field promoted to a top-level key of the object
+// rather than being nested under the "data" key.
+//
+// Data names that collide with the reserved keys of the schema ("date",
+// "dateunix", "nanoseconds", "tags", "event", and "message") are prefixed with
+// "data." to prevent overwriting the entry's own fields.  For example, a data
+// field named "message" is encoded with the key "data.message".  So that an
+// escaped name never collides with another field, names already beginning
+// with "data." are prefixed as well, e.g. a data field named "data.message" is
+// encoded with the key "data.data.message".  Removing a single "data." prefix
+// from a key always recovers the original name.
+func JSONCodecFlatData(w io.Writer) Codec {
+	return &jsonCodec{writer: w, layout: jsonDataFlat}
+}
+
+// JSONCodecExpandDots creates a Codec that writes encoded log entries as JSON
+// objects to w, with data field names containing dots expanded into nested
+// objects.  For example, a data field named "http.request.method" is encoded as
+// {"http":{"request":{"method":...}}} under the "data" key, and fields sharing
+// a prefix are merged into the same object.
+//
+// When a field names a path that is also the prefix of another field (such as
+// "http" and "http.status"), the object is kept and the value of the shorter
+// field is recorded under the empty key of the object, e.g.
+// {"http":{"":...,"status":...}}.  This is independent of the order of the
+// fields.  Names with empty path elements (such as "a..b" or "a.") are not
+// expanded.
+func JSONCodecExpandDots(w io.Writer) Codec {
+	return &jsonCodec{writer: w, layout: jsonDataExpanded}
+}
+
+func init() {
+	// Entries of format-switching codecs are newline terminated in all
+	// formats.
+	formatConstructors[FormatJSON] = func(w io.Writer) Codec {
+		return FramingCodec(w, nil, []byte{'\n'}, JSONCodec)
+	}
+}
+
+var jsonReservedKeys = map[string]struct{}{
+	"date":        {},
+	"dateunix":    {},
+	"nanoseconds": {},
+	"tags":        {},
+	"event":       {},
+	"message":     {},
+}
+
+func eventName(data []Data) string {
+	for i := range data {
+		if data[i].event {
+			return data[i].string
+		}
+	}
+	return ""
 }
 
 func mapKV(tags []KV) []string {
@@ -58,23 +200,104 @@ func mapKV(tags []KV) []string {
 	return r
 }
 
-func mapData(data []Data) map[string]interface{} {
+func mapData(tags []KV, data []Data) map[string]interface{} {
+	debug := hasDebugTag(tags)
 	r := make(map[string]interface{})
 	for i := range data {
-		r[data[i].Name()] = data[i].Value()
+		if data[i].event || (data[i].debugOnly && !debug) {
+			continue
+		}
+		r[data[i].Name()] = jsonValue(&data[i])
 	}
 	return r
 }
 
-func (c *jsonCodec) EncodeLogEntry(t time.Time, tags []KV, message string, data []Data, encodeDone func(), writeReady <-chan struct{}) {
-	b, err := json.Marshal(jsonSchema{
+// jsonObject is an object created when expanding dotted data names, and is
+// distinguished from map values logged by the application.
+type jsonObject map[string]interface{}
+
+// expandDots returns the data map m with dotted names expanded into nested
+// objects.
+func expandDots(m map[string]interface{}) map[string]interface{} {
+	r := make(map[string]interface{}, len(m))
+	for name, v := range m {
+		path := strings.Split(name, ".")
+		for _, p := range path {
+			if p == "" {
+				path = []string{name}
+				break
+			}
+		}
+		obj := jsonObject(r)
+		for _, p := range path[:len(path)-1] {
+			child, ok := obj[p].(jsonObject)
+			if !ok {
+				child = make(jsonObject)
+				if leaf, ok := obj[p]; ok {
+					child[""] = leaf
+				}
+				obj[p] = child
+			}
+			obj = child
+		}
+		last := path[len(path)-1]
+		if child, ok := obj[last].(jsonObject); ok {
+			child[""] = v
+		} else {
+			obj[last] = v
+		}
+	}
+	return r
+}
+
+func mapFlat(t time.Time, tags []KV, message string, data []Data) map[string]interface{} {
+	debug := hasDebugTag(tags)
+	r := make(map[string]interface{}, len(jsonReservedKeys)+len(data))
+	for i := range data {
+		if data[i].event {
+			r["event"] = data[i].string
+			continue
+		}
+		if data[i].debugOnly && !debug {
+			continue
+		}
+		name := data[i].Name()
+		if _, ok := jsonReservedKeys[name]; ok || strings.HasPrefix(name, "data.") {
+			name = "data." + name
+		}
+		r[name] = jsonValue(&data[i])
+	}
+	r["date"] = t.Format(TimeFormat)
+	r["dateunix"] = t.Unix()
+	r["nanoseconds"] = int64(t.Nanosecond())
+	if len(tags) != 0 {
+		r["tags"] = mapKV(tags)
+	}
+	r["message"] = message
+	return r
+}
+
+func encodeJSON(t time.Time, tags []KV, message string, data []Data, layout jsonDataLayout) ([]byte, error) {
+	if layout == jsonDataFlat {
+		return json.Marshal(mapFlat(t, tags, message, data))
+	}
+	m := mapData(tags, data)
+	if layout == jsonDataExpanded {
+		m = expandDots(m)
+	}
+	return json.Marshal(jsonSchema{
 		Date:        t.Format(TimeFormat),
 		DateUnix:    t.Unix(),
 		NanoSeconds: int64(t.Nanosecond()),
 		Tags:        mapKV(tags),
+		Event:       eventName(data),
 		Message:     message,
-		Data:        mapData(data),
+		Data:        m,
 	})
+}
+
+func (c *jsonCodec) EncodeLogEntry(t time.Time, tags []KV, message string, data []Data, encodeDone func(), writeReady <-chan struct{}) {
+	b, err := encodeJSON(t, tags, message, data, c.layout)
 	encodeDone()
 	if err != nil {
 		return
@@ -82,3 +305,75 @@ func (c *jsonCodec) EncodeLogEntry(t time.Time, tags []KV, message string, data
 	<-writeReady
 	c.writer.Write(b)
 }
+
+// Flush flushes the underlying writer if it implements Flusher.
+func (c *jsonCodec) Flush() error {
+	if f, ok := c.writer.(Flusher); ok {
+		return f.Flush()
+	}
+	return nil
+}
+
+// CloserCodec is a Codec which must be closed to finish writing its output.
+type CloserCodec interface {
+	Codec
+	io.Closer
+}
+
+type jsonArrayCodec struct {
+	writer io.Writer
+	first  bool
+	closed bool
+	mu     sync.Mutex
+}
+
+// JSONArrayCodec creates a CloserCodec that writes log entries to w as elements
+// of a single JSON array, using the same schema as JSONCodec.  The opening
+// bracket of the array is written immediately, and any error writing it is
+// returned.  The array is terminated by calling Close, which waits for all
+// entries logged up to now to be written (see Sync).  Entries logged after the
+// codec is closed are discarded.
+func JSONArrayCodec(w io.Writer) (CloserCodec, error) {
+	if _, err := io.WriteString(w, "[\n"); err != nil {
+		return nil, err
+	}
+	return &jsonArrayCodec{writer: w, first: true}, nil
+}
+
+func (c *jsonArrayCodec) EncodeLogEntry(t time.Time, tags []KV, message string, data []Data, encodeDone func(), writeReady <-chan struct{}) {
+	b, err := encodeJSON(t, tags, message, data, jsonDataNested)
+	encodeDone()
+	<-writeReady
+	if err != nil {
+		return
+	}
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if c.closed {
+		return
+	}
+	if !c.first {
+		b = append([]byte(",\n"), b...)
+	}
+	c.first = false
+	c.writer.Write(b)
+}
+
+// Close writes the closing bracket of the JSON array.  Only the first call to
+// Close writes to the underlying writer.
+func (c *jsonArrayCodec) Close() error {
+	Sync()
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if c.closed {
+		return nil
+	}
+	c.closed = true
+	s := "\n]\n"
+	if c.first {
+		s = "]\n"
+	}
+	_, err := io.WriteString(c.writer, s)
+	return err
+}
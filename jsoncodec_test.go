@@ -0,0 +1,212 @@
+// Copyright (c) 2017 Josh Rickmar
+// Use of this source code is governed by an ISC
+// license that can be found in the LICENSE file.
+
+//+build !nojson
+
+package mill
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"sync"
+	"testing"
+)
+
+func TestJSONCodecFlatData(t *testing.T) {
+	buf := &bytes.Buffer{}
+	ctx := WithLogger(context.Background(), JSONCodecFlatData(buf))
+	Log(WithLogTag(ctx, "tag"), "the message",
+		String("user", "alice"), Int64("count", 3), String("message", "data message"),
+		String("data.message", "dotted message"))
+	Sync()
+	t.Log("\n" + buf.String())
+
+	var entry map[string]interface{}
+	if err := json.Unmarshal(buf.Bytes(), &entry); err != nil {
+		t.Fatal(err)
+	}
+	if _, ok := entry["data"]; ok {
+		t.Error("data is nested")
+	}
+	if entry["user"] != "alice" {
+		t.Errorf("unexpected user %v", entry["user"])
+	}
+	if entry["count"] != 3.0 {
+		t.Errorf("unexpected count %v", entry["count"])
+	}
+	if entry["message"] != "the message" {
+		t.Errorf("reserved message key was overwritten: %v", entry["message"])
+	}
+	if entry["data.message"] != "data message" {
+		t.Errorf("unexpected data.message %v", entry["data.message"])
+	}
+	if entry["data.data.message"] != "dotted message" {
+		t.Errorf("unexpected data.data.message %v", entry["data.data.message"])
+	}
+	if tags, ok := entry["tags"].([]interface{}); !ok || len(tags) != 1 || tags[0] != "tag" {
+		t.Errorf("unexpected tags %v", entry["tags"])
+	}
+}
+
+func TestJSONCodecExpandDots(t *testing.T) {
+	tests := []struct {
+		data []Data
+		want string
+	}{
+		{
+			[]Data{String("http.request.method", "GET"), String("http.request.path", "/"), Int64("http.status", 200)},
+			`{"http":{"request":{"method":"GET","path":"/"},"status":200}}`,
+		},
+		{
+			[]Data{String("user", "alice"), String("a..b", "x"), String("c.", "y")},
+			`{"a..b":"x","c.":"y","user":"alice"}`,
+		},
+		{
+			[]Data{String("http", "leaf"), Int64("http.status", 200)},
+			`{"http":{"":"leaf","status":200}}`,
+		},
+		{
+			[]Data{Int64("http.status", 200), String("http", "leaf")},
+			`{"http":{"":"leaf","status":200}}`,
+		},
+		{
+			[]Data{Any("m", map[string]int{"a": 1}), Int64("m.b", 2)},
+			`{"m":{"":{"a":1},"b":2}}`,
+		},
+	}
+	for i, test := range tests {
+		buf := &bytes.Buffer{}
+		ctx := WithLogger(context.Background(), JSONCodecExpandDots(buf))
+		Log(ctx, "message", test.data...)
+		Sync()
+
+		var entry struct {
+			Data json.RawMessage `json:"data"`
+		}
+		if err := json.Unmarshal(buf.Bytes(), &entry); err != nil {
+			t.Fatal(err)
+		}
+		if string(entry.Data) != test.want {
+			t.Errorf("test %d: data %s, want %s", i, entry.Data, test.want)
+		}
+	}
+}
+
+func TestLogWithJSONCodecIsAsync(t *testing.T) {
+	// This will deadlock or timeout if it is not async.
+	w := &blockingConcurrentSafeBuffer{c: make(chan struct{})}
+	ctx := WithLogger(context.Background(), JSONCodec(w))
+	Log(ctx, "message 1")
+	Log(ctx, "message 2")
+	Log(ctx, "message 3")
+	if len(w.buf.Bytes()) != 0 {
+		t.Fatal("blockingWriter isn't blocking")
+	}
+	close(w.c)
+	Sync()
+	t.Log("\n" + w.buf.String())
+}
+
+func TestJSONCodecByteSize(t *testing.T) {
+	buf := &bytes.Buffer{}
+	ctx := WithLogger(context.Background(), JSONCodec(buf))
+	Log(ctx, "message", ByteSize("size", 1073741824))
+	Sync()
+
+	if !bytes.Contains(buf.Bytes(), []byte(`"data":{"size":1073741824}`)) {
+		t.Errorf("unexpected output %s", buf.Bytes())
+	}
+}
+
+type stringerMarshaler struct{}
+
+func (stringerMarshaler) String() string               { return "string" }
+func (stringerMarshaler) MarshalJSON() ([]byte, error) { return []byte(`"json"`), nil }
+
+func TestJSONCodecPrefersStringer(t *testing.T) {
+	buf := &bytes.Buffer{}
+	ctx := WithLogger(context.Background(), JSONCodec(buf))
+	Log(ctx, "message", Any("v", stringerMarshaler{}), Lazy("lazy", func() interface{} { return stringerMarshaler{} }))
+	Sync()
+
+	if !bytes.Contains(buf.Bytes(), []byte(`"data":{"lazy":"string","v":"string"}`)) {
+		t.Errorf("unexpected output %s", buf.Bytes())
+	}
+}
+
+func TestJSONArrayCodec(t *testing.T) {
+	for _, n := range []int{0, 1, 100} {
+		buf := &bytes.Buffer{}
+		c, err := JSONArrayCodec(buf)
+		if err != nil {
+			t.Fatal(err)
+		}
+		ctx := WithLogger(context.Background(), c)
+		var wg sync.WaitGroup
+		wg.Add(n)
+		for i := 0; i < n; i++ {
+			i := i
+			go func() {
+				Log(ctx, "message", Int64("i", int64(i)))
+				wg.Done()
+			}()
+		}
+		wg.Wait()
+		if err := c.Close(); err != nil {
+			t.Fatal(err)
+		}
+		c.Close()
+		Log(ctx, "after close")
+		Sync()
+
+		var entries []jsonSchema
+		if err := json.Unmarshal(buf.Bytes(), &entries); err != nil {
+			t.Fatalf("%d entries: invalid JSON array: %v\n%s", n, err, buf.Bytes())
+		}
+		if len(entries) != n {
+			t.Errorf("expected %d entries, got %d", n, len(entries))
+		}
+	}
+}
+
+func TestEvent(t *testing.T) {
+	text, js, flat := &bytes.Buffer{}, &bytes.Buffer{}, &bytes.Buffer{}
+	ctx := WithLogger(context.Background(), TextCodec(text))
+	ctx = WithLogger(ctx, JSONCodec(js))
+	ctx = WithLogger(ctx, JSONCodecFlatData(flat))
+	Event(ctx, "user_signup", String("plan", "pro"), String("event", "data field"))
+	Log(ctx, "not an event")
+	Sync()
+
+	if !bytes.HasSuffix(bytes.SplitN(text.Bytes(), []byte("\n"), 2)[0], []byte("] user_signup, plan=pro, event=data field")) {
+		t.Errorf("unexpected text output %q", text.Bytes())
+	}
+
+	dec := json.NewDecoder(js)
+	var entry map[string]interface{}
+	if err := dec.Decode(&entry); err != nil {
+		t.Fatal(err)
+	}
+	data := entry["data"].(map[string]interface{})
+	if entry["event"] != "user_signup" || entry["message"] != "user_signup" ||
+		data["plan"] != "pro" || data["event"] != "data field" {
+		t.Errorf("unexpected JSON event entry %v", entry)
+	}
+	entry = nil
+	if err := dec.Decode(&entry); err != nil {
+		t.Fatal(err)
+	}
+	if _, ok := entry["event"]; ok {
+		t.Errorf("event field in non-event entry %v", entry)
+	}
+
+	entry = nil
+	if err := json.NewDecoder(flat).Decode(&entry); err != nil {
+		t.Fatal(err)
+	}
+	if entry["event"] != "user_signup" || entry["data.event"] != "data field" || entry["plan"] != "pro" {
+		t.Errorf("unexpected flat JSON event entry %v", entry)
+	}
+}
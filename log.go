@@ -7,17 +7,35 @@ package mill
 import (
 	"context"
 	"sync"
+	"sync/atomic"
 	"time"
 )
 
 var globalLogSyncer struct {
 	writeReady chan struct{}
+
+	// codecWrites records a channel for each independent codec with writes
+	// in progress, which is closed once the codec's most recent write has
+	// finished.
+	codecWrites map[*independentCodec]chan struct{}
+
+	mu sync.Mutex
+}
+
+// pendingWrites bounds the number of log entries that have been encoded but not
+// yet written by all codecs.
+var pendingWrites struct {
+	count, max int
 	mu         sync.Mutex
+	cond       sync.Cond
 }
 
 func init() {
+	pendingWrites.cond.L = &pendingWrites.mu
+
 	globalLogSyncer.writeReady = make(chan struct{})
 	close(globalLogSyncer.writeReady)
+	globalLogSyncer.codecWrites = make(map[*independentCodec]chan struct{})
 }
 
 type loggerKey struct{}
@@ -61,7 +79,38 @@ func WithLogTagPair(ctx context.Context, k, v string) context.Context {
 	return context.WithValue(ctx, contextTags{}, append(tags, KV{k, v}))
 }
 
+type componentKey struct{}
+
+// WithComponent creates a copy of the context describing a named component of
+// the program, such as "storage".  The component is added as a "component" tag
+// pair to all entries logged using the context, and debug logging can be
+// enabled for just this component (see SetComponentDebugEnabled).  Components
+// do not nest; the innermost component replaces any outer component for debug
+// gating.
+func WithComponent(ctx context.Context, name string) context.Context {
+	ctx = WithLogTagPair(ctx, "component", name)
+	return context.WithValue(ctx, componentKey{}, name)
+}
+
+func contextComponent(ctx context.Context) string {
+	if v := ctx.Value(componentKey{}); v != nil {
+		return v.(string)
+	}
+	return ""
+}
+
+type silenceKey struct{}
+
+// WithSilence creates a copy of the context in which all calls to Log and Debug
+// are ignored.  The loggers and tags of the context remain attached and the
+// parent context is unaffected.
+func WithSilence(ctx context.Context) context.Context {
+	return context.WithValue(ctx, silenceKey{}, struct{}{})
+}
+
 // Codec is used to encode a log entry and write it to an underlying writer.
+// Codecs may additionally implement BatchCodec to encode multiple entries at
+// once.
 type Codec interface {
 	// EncodeLogEntry encodes a log entry and writes it to an underlying writer.
 	//
@@ -73,7 +122,8 @@ type Codec interface {
 	// encoding has finished (and none of the data values will be read again),
 	// encodeDone must be called.  This signals to the Log function that it is
 	// safe to return since there is no posibility of data racing on mutable
-	// data passed to Log.
+	// data passed to Log.  Codecs that retain entry data after encodeDone is
+	// called must copy it first (see CopyData).
 	//
 	// To prevent out-of-order written log entries, the write of the encoded
 	// entry must only be written once a read of the writeReady channel
@@ -81,6 +131,14 @@ type Codec interface {
 	EncodeLogEntry(t time.Time, tags []KV, message string, data []Data, encodeDone func(), writeReady <-chan struct{})
 }
 
+// dropEntry finishes a log entry which a codec does not write.  Even though
+// nothing is written, the codec must wait for the previous entry to be written
+// so that the next entry is not written before it.
+func dropEntry(encodeDone func(), writeReady <-chan struct{}) {
+	encodeDone()
+	<-writeReady
+}
+
 // Log logs to all attached loggers of the context.  The message parameter
 // describes what event or situation is being logged, and additional values of
 // importance can be passed to the data slice.
@@ -91,11 +149,39 @@ type Codec interface {
 // writers is done in the background.  This prevents the possibility of inducing
 // a data race by trying to log a mutable parameter.
 func Log(ctx context.Context, message string, data ...Data) {
+	log(ctx, nil, message, data)
+}
+
+// LogTo logs a message and additional data to only the loggers of the context
+// for which selector returns true, such as writing verbose diagnostics only to
+// a log file and not the terminal.  The entry is ordered with all other
+// entries as if it were logged using Log.  If no loggers are selected, the
+// entry is not logged.  Loggers are passed to selector as they were attached
+// by WithLogger.
+func LogTo(ctx context.Context, selector func(Codec) bool, message string, data ...Data) {
+	log(ctx, selector, message, data)
+}
+
+func log(ctx context.Context, selector func(Codec) bool, message string, data []Data) {
+	if ctx.Value(silenceKey{}) != nil {
+		return
+	}
+
 	var loggers []Codec
 	if v := ctx.Value(loggerKey{}); v != nil {
 		loggers = v.([]Codec)
-	} else {
-		return
+	}
+	if selector != nil && len(loggers) != 0 {
+		var selected []Codec
+		for _, c := range loggers {
+			if selector(c) {
+				selected = append(selected, c)
+			}
+		}
+		if len(selected) == 0 {
+			return
+		}
+		loggers = selected
 	}
 
 	var tags []KV
@@ -103,31 +189,107 @@ func Log(ctx context.Context, message string, data ...Data) {
 		tags = v.([]KV)
 	}
 
+	format := contextFormat(ctx)
+	if len(loggers) == 0 {
+		bufferEarlyEntry(format, time.Time{}, tags, message, data)
+		return
+	}
+	tags, message, data = intercept(tags, message, data)
+	if bufferTxEntry(ctx, loggers, format, time.Time{}, tags, message, data) {
+		return
+	}
+	logEntry(loggers, format, time.Time{}, tags, message, data)
+}
+
+// Event logs a discrete, named event (e.g. "user_signup") to all attached
+// loggers of the context.  The event name is used as the message of the log
+// entry and is additionally recorded as a String data field named "event"
+// (see Data.IsEvent) that codecs may encode as a dedicated, first-class field
+// of the entry, allowing events to be reliably aggregated by name.  The JSON
+// codecs record it with the top-level "event" key, while the text codec omits
+// it as it would duplicate the message.
+func Event(ctx context.Context, name string, data ...Data) {
+	event := String("event", name)
+	event.event = true
+	event.textOmit = true
+	Log(ctx, name, append([]Data{event}, data...)...)
+}
+
+// logEntry encodes and writes a log entry to all loggers, returning once all
+// encoding has finished.  Format-switching codecs encode the entry using
+// format.  If t is the zero time, the entry is timestamped with the current
+// time.
+func logEntry(loggers []Codec, format Format, t time.Time, tags []KV, message string, data []Data) {
+	start := time.Now()
+	acquirePendingWrite()
+
 	// to prevent entries from showing out of order depending on how long they
 	// took to encode, block the write until the previous (if any) has finished.
 	// The encoding operation itself is not blocked at all.
 	globalLogSyncer.mu.Lock()
-	writeReady := globalLogSyncer.writeReady
-	nextWriteReady := make(chan struct{})
-	globalLogSyncer.writeReady = nextWriteReady
+	entryReady := globalLogSyncer.writeReady
+	nextEntryReady := make(chan struct{})
+	globalLogSyncer.writeReady = nextEntryReady
 	// Getting the current time must be done before any other calls to Log add
 	// other writers, or log timestamps may appear out of order, even though the
 	// logs messages themselves are ordered correctly.
-	t := time.Now()
+	if t.IsZero() {
+		t = time.Now()
+	}
+	if atomic.LoadInt32(&timestampsUTC) != 0 {
+		t = t.UTC()
+	}
+	if len(loggers) == 1 {
+		// Fast path for the common case of a single codec, which avoids
+		// the additional goroutine and wait groups of writeEntry.
+		c := loggers[0]
+		writeReady, writeDone := trackCodecWrite(c, entryReady)
+		globalLogSyncer.mu.Unlock()
+
+		s := encodeSyncPool.Get().(*encodeSync)
+		s.wg.Add(1)
+		go func() {
+			encodeLogEntry(c, format, t, tags, message, data, s.done, writeReady)
+			codecWriteFinished(c, writeDone)
+			entryWritesFinished(start, 1, entryReady, nextEntryReady)
+		}()
+		s.wg.Wait()
+		encodeSyncPool.Put(s)
+		recordEncode(start, 1)
+		return
+	}
+
+	writeEntry(loggers, start, 1, entryReady, nextEntryReady, func(c Codec, encodeDone func(), writeReady <-chan struct{}) {
+		encodeLogEntry(c, format, t, tags, message, data, encodeDone, writeReady)
+	})
+}
+
+// writeEntry encodes and writes n log entries to all loggers using encode,
+// returning once all encoding has finished.  It must be called with
+// globalLogSyncer.mu held, and unlocks it.
+func writeEntry(loggers []Codec, start time.Time, n int, entryReady, nextEntryReady chan struct{},
+	encode func(c Codec, encodeDone func(), writeReady <-chan struct{})) {
+
+	writeReady := make([]<-chan struct{}, len(loggers))
+	writeDone := make([]chan struct{}, len(loggers))
+	for i, c := range loggers {
+		writeReady[i], writeDone[i] = trackCodecWrite(c, entryReady)
+	}
 	globalLogSyncer.mu.Unlock()
 
 	var writesDone, encodesDone sync.WaitGroup
 	writesDone.Add(len(loggers))
 	encodesDone.Add(len(loggers))
-	for _, c := range loggers {
-		go func(c Codec) {
-			c.EncodeLogEntry(t, tags, message, data, encodesDone.Done, writeReady)
+	for i, c := range loggers {
+		go func(c Codec, writeReady <-chan struct{}, writeDone chan struct{}) {
+			encode(c, encodesDone.Done, writeReady)
+			codecWriteFinished(c, writeDone)
 			writesDone.Done()
-		}(c)
+		}(c, writeReady[i], writeDone[i])
 	}
 	go func() {
 		writesDone.Wait()
-		close(nextWriteReady)
+		entryWritesFinished(start, n, entryReady, nextEntryReady)
 	}()
 
 	// Only safe to return to caller once all encoding has been completed, even
@@ -135,6 +297,126 @@ func Log(ctx context.Context, message string, data ...Data) {
 	// allows for async logging without fear of holding references to mutable
 	// data and causing a data race.
 	encodesDone.Wait()
+	recordEncode(start, uint64(n))
+}
+
+// encodeSync is used to wait for a single codec to finish encoding.  The done
+// method value is created once so that pooled encodeSyncs may be reused
+// without allocating.
+type encodeSync struct {
+	wg   sync.WaitGroup
+	done func()
+}
+
+var encodeSyncPool = sync.Pool{
+	New: func() interface{} {
+		s := new(encodeSync)
+		s.done = s.wg.Done
+		return s
+	},
+}
+
+// closedChan is a closed channel, used as the write ready channel of codecs
+// without writes in progress.
+var closedChan = make(chan struct{})
+
+func init() {
+	close(closedChan)
+}
+
+type independentCodec struct {
+	Codec
+}
+
+// IndependentCodec returns a Codec which encodes entries with c, but whose
+// writes are ordered only with its own previous writes rather than with the
+// writes of all codecs.  A stalled sibling codec attached to the same context
+// never delays the writes of an independent codec, allowing it to be flushed
+// separately (see FlushCodec).  Codecs sharing an underlying writer should not
+// be independent, as their entries may then be interleaved out of order.
+//
+// Writes of an independent codec are still waited on by Sync, and by the
+// writes of later entries of codecs that are not independent.
+func IndependentCodec(c Codec) Codec {
+	return &independentCodec{c}
+}
+
+// EncodeLogEntries implements the BatchCodec interface.
+func (c *independentCodec) EncodeLogEntries(entries []EntrySnapshot, encodeDone func(), writeReady <-chan struct{}) {
+	if bc, ok := c.Codec.(BatchCodec); ok {
+		bc.EncodeLogEntries(entries, encodeDone, writeReady)
+		return
+	}
+	encodeEach(c.Codec, FormatText, entries, encodeDone, writeReady)
+}
+
+// Flush flushes the inner codec if it implements Flusher.
+func (c *independentCodec) Flush() error {
+	if f, ok := c.Codec.(Flusher); ok {
+		return f.Flush()
+	}
+	return nil
+}
+
+// trackCodecWrite records a new write in progress by c, returning the channel
+// that must be read before c may write, and the channel to close once the
+// write has finished.  Codecs which are not independent (see IndependentCodec)
+// are ordered by entryReady, the completion of all writes of the previous
+// entry, and a nil done channel is returned.  It must be called with
+// globalLogSyncer.mu held.
+func trackCodecWrite(c Codec, entryReady chan struct{}) (writeReady <-chan struct{}, done chan struct{}) {
+	ic, ok := c.(*independentCodec)
+	if !ok {
+		return entryReady, nil
+	}
+	done = make(chan struct{})
+	prev, ok := globalLogSyncer.codecWrites[ic]
+	globalLogSyncer.codecWrites[ic] = done
+	if !ok {
+		return closedChan, done
+	}
+	return prev, done
+}
+
+// codecWriteFinished marks the write of c described by done as finished,
+// removing the record of the codec's writes in progress if it was the most
+// recent.
+func codecWriteFinished(c Codec, done chan struct{}) {
+	if done == nil {
+		return
+	}
+	close(done)
+	ic := c.(*independentCodec)
+	globalLogSyncer.mu.Lock()
+	if globalLogSyncer.codecWrites[ic] == done {
+		delete(globalLogSyncer.codecWrites, ic)
+	}
+	globalLogSyncer.mu.Unlock()
+}
+
+// acquirePendingWrite applies backpressure to the caller if too many previous
+// entries are still waiting to be written.
+func acquirePendingWrite() {
+	pendingWrites.mu.Lock()
+	for pendingWrites.max > 0 && pendingWrites.count >= pendingWrites.max {
+		pendingWrites.cond.Wait()
+	}
+	pendingWrites.count++
+	pendingWrites.mu.Unlock()
+}
+
+// entryWritesFinished is called once all codecs have finished writing n
+// entries.  Once all previous entries have been written (entryReady is
+// closed), the entries are recorded as written and nextEntryReady is closed.
+func entryWritesFinished(start time.Time, n int, entryReady, nextEntryReady chan struct{}) {
+	<-entryReady
+	recordWrite(start, uint64(n))
+	close(nextEntryReady)
+
+	pendingWrites.mu.Lock()
+	pendingWrites.count--
+	pendingWrites.mu.Unlock()
+	pendingWrites.cond.Broadcast()
 }
 
 // Debug is a debugging log function that adds an extra "debug" log tag to each
@@ -171,13 +453,118 @@ func SetGlobalDebuggingEnabled(enabled bool) {
 	setGlobalDebuggingEnabled(enabled)
 }
 
+// SetComponentDebugEnabled enables or disables debug logging for all contexts
+// of the named component (see WithComponent) in non-release builds.  Debug log
+// entries are created if debugging is enabled for the component, the context
+// (see SetDebuggingEnabled), or globally (see SetGlobalDebuggingEnabled).
+func SetComponentDebugEnabled(component string, enabled bool) {
+	setComponentDebugEnabled(component, enabled)
+}
+
+var timestampsUTC int32 // atomic
+
+// SetTimestampsUTC sets whether log entry timestamps are converted to UTC before
+// being encoded, rather than using the local time zone.  This is useful for
+// correlating the logs of hosts in different time zones.  UTC timestamps
+// formatted with TimeFormat remain lexicographically comparable.
+func SetTimestampsUTC(enabled bool) {
+	var v int32
+	if enabled {
+		v = 1
+	}
+	atomic.StoreInt32(&timestampsUTC, v)
+}
+
+// SetMaxPendingWrites sets the maximum number of log entries that may be encoded
+// but not yet written to all codecs' underlying writers.  When this limit is
+// reached, Log blocks before encoding until previous entries have been written.
+// This applies backpressure to callers logging faster than the writers can
+// keep up, rather than allowing queued writes (and memory usage) to grow without
+// bound.
+//
+// A limit of zero (the default) removes the bound.
+func SetMaxPendingWrites(max int) {
+	pendingWrites.mu.Lock()
+	pendingWrites.max = max
+	pendingWrites.mu.Unlock()
+	pendingWrites.cond.Broadcast()
+}
+
+// Flusher is implemented by codecs which are able to flush buffered output
+// (such as a buffered underlying writer) to its final destination.
+type Flusher interface {
+	Flush() error
+}
+
+// FlushCodec blocks until the codec c has finished writing all log entries
+// created up to now, and then flushes the codec if it implements Flusher.
+// If c was created by IndependentCodec, FlushCodec does not wait for other
+// codecs to finish writing their entries.  The writes of all other codecs are
+// ordered with the writes of every codec, so for them FlushCodec waits for all
+// writes as Sync does.
+//
+// The codecs of this package implement Flusher by flushing their underlying
+// writer if it also implements Flusher (such as a *bufio.Writer).
+func FlushCodec(c Codec) error {
+	if ic, ok := c.(*independentCodec); ok {
+		globalLogSyncer.mu.Lock()
+		writeDone := globalLogSyncer.codecWrites[ic]
+		globalLogSyncer.mu.Unlock()
+		if writeDone != nil {
+			<-writeDone
+		}
+	} else {
+		waitWrites()
+	}
+	if f, ok := c.(Flusher); ok {
+		return f.Flush()
+	}
+	return nil
+}
+
+// syncFlushers are the codecs which are flushed by Sync.
+var syncFlushers = struct {
+	m  map[Flusher]struct{}
+	mu sync.Mutex
+}{m: make(map[Flusher]struct{})}
+
+// FlushOnSync adds or removes f from the codecs flushed by Sync.  Codecs which
+// deliver entries in batches should add themselves when created and remove
+// themselves when closed, so that Sync delivers all entries logged before it.
+func FlushOnSync(f Flusher, flush bool) {
+	syncFlushers.mu.Lock()
+	if flush {
+		syncFlushers.m[f] = struct{}{}
+	} else {
+		delete(syncFlushers.m, f)
+	}
+	syncFlushers.mu.Unlock()
+}
+
 // Sync blocks until all loggers have finished writing all log entries created
 // up to now.  Note that does not also block on any concurrent logs started
-// after Sync is called.
+// after Sync is called.  Codecs added by FlushOnSync, such as an HTTPBatcher,
+// are then flushed, and Sync returns once the delivery of their pending entries
+// has finished or failed.
 //
 // Sync should be called before flushing each codec's underlying writer to
 // ensure that all log entries created before now are written.
 func Sync() {
+	waitWrites()
+
+	syncFlushers.mu.Lock()
+	flushers := make([]Flusher, 0, len(syncFlushers.m))
+	for f := range syncFlushers.m {
+		flushers = append(flushers, f)
+	}
+	syncFlushers.mu.Unlock()
+	for _, f := range flushers {
+		f.Flush()
+	}
+}
+
+// waitWrites blocks until all log entries created up to now are written.
+func waitWrites() {
 	globalLogSyncer.mu.Lock()
 	writesDone := globalLogSyncer.writeReady
 	globalLogSyncer.mu.Unlock()
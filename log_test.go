@@ -5,8 +5,10 @@
 package mill
 
 import (
+	"bufio"
 	"bytes"
 	"context"
+	"io/ioutil"
 	"strconv"
 	"sync"
 	"testing"
@@ -50,21 +52,6 @@ func TestLogWithTextCodecIsAsync(t *testing.T) {
 	t.Log("\n" + w.buf.String())
 }
 
-func TestLogWithJSONCodecIsAsync(t *testing.T) {
-	// This will deadlock or timeout if it is not async.
-	w := &blockingConcurrentSafeBuffer{c: make(chan struct{})}
-	ctx := WithLogger(context.Background(), JSONCodec(w))
-	Log(ctx, "message 1")
-	Log(ctx, "message 2")
-	Log(ctx, "message 3")
-	if len(w.buf.Bytes()) != 0 {
-		t.Fatal("blockingWriter isn't blocking")
-	}
-	close(w.c)
-	Sync()
-	t.Log("\n" + w.buf.String())
-}
-
 type intStringer struct{ i int }
 
 func (s *intStringer) String() string { return strconv.FormatInt(int64(s.i), 10) }
@@ -163,3 +150,202 @@ func TestMultiContextLogEntriesAreOrdered(t *testing.T) {
 		// TODO: compare data parameter i
 	}
 }
+
+type recordedEntry struct {
+	t       time.Time
+	tags    []KV
+	message string
+	data    []Data
+}
+
+// recordingCodec records all log entries it encodes.
+type recordingCodec struct {
+	entries []recordedEntry
+	mu      sync.Mutex
+}
+
+func (c *recordingCodec) EncodeLogEntry(t time.Time, tags []KV, message string, data []Data, encodeDone func(), writeReady <-chan struct{}) {
+	e := recordedEntry{
+		t:       t,
+		tags:    append([]KV(nil), tags...),
+		message: message,
+		data:    CopyData(data),
+	}
+	encodeDone()
+	<-writeReady
+	c.mu.Lock()
+	c.entries = append(c.entries, e)
+	c.mu.Unlock()
+}
+
+func TestLogBackpressure(t *testing.T) {
+	SetMaxPendingWrites(2)
+	defer SetMaxPendingWrites(0)
+
+	w := &blockingConcurrentSafeBuffer{c: make(chan struct{})}
+	ctx := WithLogger(context.Background(), TextCodec(w))
+	Log(ctx, "message 1")
+	Log(ctx, "message 2")
+
+	logged := make(chan struct{})
+	go func() {
+		Log(ctx, "message 3")
+		close(logged)
+	}()
+	select {
+	case <-logged:
+		t.Fatal("Log did not block with too many pending writes")
+	case <-time.After(50 * time.Millisecond):
+	}
+
+	close(w.c)
+	select {
+	case <-logged:
+	case <-time.After(5 * time.Second):
+		t.Fatal("Log remained blocked after writes drained")
+	}
+	Sync()
+
+	lines := bytes.Split(w.buf.Bytes(), []byte("\n"))
+	if len(lines) != 4 || len(lines[3]) != 0 {
+		t.Fatal("expected 3 lines")
+	}
+}
+
+func TestWithSilence(t *testing.T) {
+	SetGlobalDebuggingEnabled(true)
+	defer SetGlobalDebuggingEnabled(false)
+
+	buf := &bytes.Buffer{}
+	ctx := WithLogger(context.Background(), TextCodec(buf))
+	silent := WithSilence(WithLogTag(ctx, "noisy"))
+	Log(silent, "silenced")
+	Debug(silent, "silenced debug")
+	Log(WithLogTag(silent, "child"), "silenced child")
+	Log(ctx, "parent")
+	Sync()
+
+	lines := bytes.Split(buf.Bytes(), []byte("\n"))
+	if len(lines) != 2 || !bytes.HasSuffix(lines[0], []byte("[] parent")) {
+		t.Errorf("unexpected output %q", buf.Bytes())
+	}
+}
+
+func TestFlushCodecIgnoresStalledSibling(t *testing.T) {
+	stalled := &blockingConcurrentSafeBuffer{c: make(chan struct{})}
+	defer func() {
+		close(stalled.c)
+		Sync()
+	}()
+	var fast bytes.Buffer
+	bw := bufio.NewWriter(&fast)
+	fastCodec := IndependentCodec(TextCodec(bw))
+	ctx := WithLogger(context.Background(), TextCodec(stalled))
+	ctx = WithLogger(ctx, fastCodec)
+	for i := 0; i < 5; i++ {
+		Log(ctx, "message", Int64("i", int64(i)))
+	}
+
+	flushed := make(chan error)
+	go func() {
+		flushed <- FlushCodec(fastCodec)
+	}()
+	select {
+	case err := <-flushed:
+		if err != nil {
+			t.Fatal(err)
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatal("FlushCodec blocked on stalled sibling codec")
+	}
+	lines := bytes.Split(fast.Bytes(), []byte("\n"))
+	if len(lines) != 6 {
+		t.Fatalf("buffered writer was not flushed: %q", fast.Bytes())
+	}
+	for i := 0; i < 5; i++ {
+		if want := "[] message, i=" + strconv.Itoa(i); !bytes.HasSuffix(lines[i], []byte(want)) {
+			t.Errorf("line %d: %q, want suffix %q", i, lines[i], want)
+		}
+	}
+}
+
+func BenchmarkLogMessageOnly(b *testing.B) {
+	ctx := WithLogger(context.Background(), TextCodec(ioutil.Discard))
+	b.ReportAllocs()
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		Log(ctx, "just a message")
+	}
+	Sync()
+}
+
+func BenchmarkLogMultipleCodecs(b *testing.B) {
+	ctx := WithLogger(context.Background(), TextCodec(ioutil.Discard))
+	ctx = WithLogger(ctx, TextCodec(ioutil.Discard))
+	b.ReportAllocs()
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		Log(ctx, "just a message")
+	}
+	Sync()
+}
+
+func TestSetTimestampsUTC(t *testing.T) {
+	defer func(local *time.Location) { time.Local = local }(time.Local)
+	time.Local = time.FixedZone("UTC+5", 5*60*60)
+	SetTimestampsUTC(true)
+	defer SetTimestampsUTC(false)
+
+	text, c := &bytes.Buffer{}, &recordingCodec{}
+	ctx := WithLogger(context.Background(), TextCodec(text))
+	ctx = WithLogger(ctx, c)
+	Log(ctx, "message")
+	Sync()
+
+	if c.entries[0].t.Location() != time.UTC {
+		t.Errorf("timestamp location %v is not UTC", c.entries[0].t.Location())
+	}
+	timestamp := bytes.SplitN(text.Bytes(), []byte(" ["), 2)[0]
+	if !bytes.HasSuffix(timestamp, []byte("+0000")) {
+		t.Errorf("timestamp %q is not UTC", timestamp)
+	}
+
+	SetTimestampsUTC(false)
+	text.Reset()
+	Log(ctx, "message")
+	Sync()
+	timestamp = bytes.SplitN(text.Bytes(), []byte(" ["), 2)[0]
+	if !bytes.HasSuffix(timestamp, []byte("+0500")) {
+		t.Errorf("timestamp %q is not local", timestamp)
+	}
+}
+
+func TestLogTo(t *testing.T) {
+	terminal, file := &recordingCodec{}, &recordingCodec{}
+	ctx := WithLogger(context.Background(), terminal)
+	ctx = WithLogger(ctx, file)
+	onlyFile := func(c Codec) bool { return c == file }
+
+	Log(ctx, "message 1")
+	LogTo(ctx, onlyFile, "diagnostics", Int64("verbose", 1))
+	Log(ctx, "message 2")
+	LogTo(ctx, func(Codec) bool { return false }, "nowhere")
+	Sync()
+
+	if len(terminal.entries) != 2 || terminal.entries[0].message != "message 1" ||
+		terminal.entries[1].message != "message 2" {
+		t.Errorf("unexpected terminal entries %v", terminal.entries)
+	}
+	want := []string{"message 1", "diagnostics", "message 2"}
+	if len(file.entries) != len(want) {
+		t.Fatalf("unexpected file entries %v", file.entries)
+	}
+	for i, e := range file.entries {
+		if e.message != want[i] {
+			t.Errorf("file entry %d: message %q, want %q", i, e.message, want[i])
+		}
+		if i != 0 && e.t.Before(file.entries[i-1].t) {
+			t.Errorf("file entry %d is out of order", i)
+		}
+	}
+}
@@ -0,0 +1,79 @@
+// Copyright (c) 2017 Josh Rickmar
+// Use of this source code is governed by an ISC
+// license that can be found in the LICENSE file.
+
+package mill
+
+import (
+	"bytes"
+	"io"
+	"strconv"
+	"strings"
+	"time"
+)
+
+type logfmtCodec struct {
+	writer io.Writer
+}
+
+// newLogfmtCodec creates a Codec that writes log entries to w in the logfmt
+// format (see FormatLogfmt).
+func newLogfmtCodec(w io.Writer) Codec {
+	return &logfmtCodec{writer: w}
+}
+
+func writeLogfmtValue(buf *bytes.Buffer, s string) {
+	if s == "" || strings.IndexFunc(s, func(r rune) bool {
+		return r <= ' ' || r == '=' || r == '"' || r == 0x7f
+	}) != -1 {
+		s = strconv.Quote(s)
+	}
+	buf.WriteString(s)
+}
+
+func (c *logfmtCodec) EncodeLogEntry(t time.Time, tags []KV, message string, data []Data, encodeDone func(), writeReady <-chan struct{}) {
+	var buf, value bytes.Buffer
+
+	buf.WriteString("time=")
+	writeLogfmtValue(&buf, t.Format(TimeFormat))
+	if len(tags) != 0 {
+		buf.WriteString(" tags=")
+		for i := range tags {
+			if i != 0 {
+				value.WriteByte(',')
+			}
+			value.WriteString(tags[i].Key)
+			if tags[i].Value != "" {
+				value.WriteByte('=')
+				value.WriteString(tags[i].Value)
+			}
+		}
+		writeLogfmtValue(&buf, value.String())
+	}
+	buf.WriteString(" msg=")
+	writeLogfmtValue(&buf, message)
+
+	debug := hasDebugTag(tags)
+	var opts TextCodecOptions
+	for i := range data {
+		d := &data[i]
+		ty := d.Type()
+		if ty == ValueTypeUnknown || ty > valueTypeMaxValue {
+			continue
+		}
+		if d.textOmit || (d.debugOnly && !debug) {
+			continue
+		}
+		buf.WriteByte(' ')
+		buf.WriteString(d.name)
+		buf.WriteByte('=')
+		value.Reset()
+		writeTextValue(&value, d, &opts)
+		writeLogfmtValue(&buf, value.String())
+	}
+	buf.WriteByte('\n')
+	encodeDone()
+
+	<-writeReady
+	buf.WriteTo(c.writer)
+}
@@ -0,0 +1,27 @@
+// Copyright (c) 2017 Josh Rickmar
+// Use of this source code is governed by an ISC
+// license that can be found in the LICENSE file.
+
+package mill
+
+import (
+	"bytes"
+	"context"
+	"testing"
+)
+
+func TestLogfmtFormat(t *testing.T) {
+	buf := &bytes.Buffer{}
+	ctx := WithLogger(context.Background(), newLogfmtCodec(buf))
+	ctx = WithLogTagPair(WithLogTag(ctx, "web"), "region", "us east")
+	data := []Data{String("path", "/"), String("empty", ""), Int64("status", 200), String("quote", `a"b`)}
+	Log(ctx, "request handled", append(data, Attempt(2, 3, nil)...)...)
+	Sync()
+	t.Log("\n" + buf.String())
+
+	const want = ` tags="web,region=us east" msg="request handled" path=/ empty="" status=200 quote="a\"b" attempt=2/3` + "\n"
+	line := buf.Bytes()
+	if !bytes.HasPrefix(line, []byte(`time="`)) || !bytes.HasSuffix(line, []byte(want)) {
+		t.Errorf("unexpected output %q", line)
+	}
+}
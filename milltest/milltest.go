@@ -0,0 +1,49 @@
+// Copyright (c) 2017 Josh Rickmar
+// Use of this source code is governed by an ISC
+// license that can be found in the LICENSE file.
+
+// Package milltest provides mill codecs for use in tests.
+package milltest
+
+import (
+	"bytes"
+	"sync"
+	"testing"
+
+	"github.com/jrick/mill"
+)
+
+type tbWriter struct {
+	tb   testing.TB
+	done bool
+	mu   sync.Mutex
+}
+
+func (w *tbWriter) Write(p []byte) (n int, err error) {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	if w.done {
+		return len(p), nil
+	}
+	defer func() {
+		// Logging after the test has completed panics.  Writes are
+		// asynchronous and may be performed after this, so stop writing
+		// to the test once this happens.
+		if recover() != nil {
+			w.done = true
+		}
+	}()
+	w.tb.Helper()
+	w.tb.Log(string(bytes.TrimSuffix(p, []byte{'\n'})))
+	return len(p), nil
+}
+
+// TestingCodec creates a Codec that formats log entries like mill.TextCodec and
+// logs each entry using tb.Log, associating the output with the running test
+// and hiding it unless the test fails or is run in verbose mode.
+//
+// Entries written after the test has completed are discarded.  Tests should
+// call mill.Sync before returning to ensure all entries are logged.
+func TestingCodec(tb testing.TB) mill.Codec {
+	return mill.TextCodec(&tbWriter{tb: tb})
+}
@@ -0,0 +1,55 @@
+// Copyright (c) 2017 Josh Rickmar
+// Use of this source code is governed by an ISC
+// license that can be found in the LICENSE file.
+
+package milltest
+
+import (
+	"context"
+	"fmt"
+	"strings"
+	"testing"
+
+	"github.com/jrick/mill"
+)
+
+type fakeTB struct {
+	testing.TB
+	logs     []string
+	finished bool
+}
+
+func (tb *fakeTB) Helper() {}
+
+func (tb *fakeTB) Log(args ...interface{}) {
+	if tb.finished {
+		panic("Log in goroutine after test has completed")
+	}
+	tb.logs = append(tb.logs, fmt.Sprint(args...))
+}
+
+func TestTestingCodec(t *testing.T) {
+	tb := &fakeTB{TB: t}
+	ctx := mill.WithLogger(context.Background(), TestingCodec(tb))
+	mill.Log(ctx, "message 1", mill.Int64("i", 1))
+	mill.Log(ctx, "message 2")
+	mill.Sync()
+
+	if len(tb.logs) != 2 {
+		t.Fatalf("expected 2 logs, got %d", len(tb.logs))
+	}
+	if !strings.HasSuffix(tb.logs[0], "[] message 1, i=1") {
+		t.Errorf("unexpected log %q", tb.logs[0])
+	}
+	if strings.HasSuffix(tb.logs[1], "\n") {
+		t.Errorf("log %q is newline terminated", tb.logs[1])
+	}
+
+	tb.finished = true
+	mill.Log(ctx, "message 3")
+	mill.Log(ctx, "message 4")
+	mill.Sync()
+	if len(tb.logs) != 2 {
+		t.Errorf("unexpected logs after completion: %v", tb.logs[2:])
+	}
+}
@@ -0,0 +1,71 @@
+// Copyright (c) 2017 Josh Rickmar
+// Use of this source code is governed by an ISC
+// license that can be found in the LICENSE file.
+
+package mill
+
+import (
+	"context"
+	"sync"
+	"time"
+)
+
+// Operation creates a copy of the context tagged with the pair operation=name
+// and logs that the operation has started.  The returned function logs that
+// the operation has completed, along with the elapsed duration, and should be
+// deferred by the caller:
+//
+//	ctx, done := mill.Operation(ctx, "sync")
+//	defer done()
+func Operation(ctx context.Context, name string) (context.Context, func()) {
+	ctx = WithLogTagPair(ctx, "operation", name)
+	Log(ctx, "operation started")
+	start := time.Now()
+	return ctx, func() {
+		Log(ctx, "operation completed", Duration("elapsed", time.Since(start)))
+	}
+}
+
+// WatchDeadline starts watching for an operation that runs longer than
+// threshold, logging "operation still running" with the elapsed duration each
+// time another threshold elapses before the operation completes.  The returned
+// function marks the operation as completed and must be called to stop
+// watching; it is safe to call more than once.  Watching also stops if the
+// context is cancelled.  A non-positive threshold watches nothing, and the
+// returned function does nothing.
+func WatchDeadline(ctx context.Context, threshold time.Duration) func() {
+	stop, _ := watchDeadline(ctx, threshold)
+	return stop
+}
+
+// watchDeadline implements WatchDeadline, additionally returning a channel that
+// is closed once the watching goroutine has exited.
+func watchDeadline(ctx context.Context, threshold time.Duration) (stop func(), exited <-chan struct{}) {
+	exit := make(chan struct{})
+	if threshold <= 0 {
+		close(exit)
+		return func() {}, exit
+	}
+	done := make(chan struct{})
+	var once sync.Once
+	start := time.Now()
+	go func() {
+		defer close(exit)
+		ticker := time.NewTicker(threshold)
+		defer ticker.Stop()
+		for {
+			select {
+			case <-ticker.C:
+				Log(ctx, "operation still running", Duration("elapsed", time.Since(start)))
+			case <-done:
+				return
+			case <-ctx.Done():
+				return
+			}
+		}
+	}()
+	stop = func() {
+		once.Do(func() { close(done) })
+	}
+	return stop, exit
+}
@@ -0,0 +1,110 @@
+// Copyright (c) 2017 Josh Rickmar
+// Use of this source code is governed by an ISC
+// license that can be found in the LICENSE file.
+
+package mill
+
+import (
+	"context"
+	"testing"
+	"time"
+)
+
+func TestOperation(t *testing.T) {
+	c := &recordingCodec{}
+	ctx := WithLogger(context.Background(), c)
+	func() {
+		_, done := Operation(ctx, "test")
+		defer done()
+		time.Sleep(time.Millisecond)
+	}()
+	Sync()
+
+	if len(c.entries) != 2 {
+		t.Fatalf("expected 2 entries, got %d", len(c.entries))
+	}
+	for _, e := range c.entries {
+		if len(e.tags) != 1 || e.tags[0] != (KV{"operation", "test"}) {
+			t.Errorf("unexpected tags %v", e.tags)
+		}
+	}
+	if c.entries[0].message != "operation started" {
+		t.Errorf("unexpected first message %q", c.entries[0].message)
+	}
+	done := c.entries[1]
+	if done.message != "operation completed" {
+		t.Errorf("unexpected second message %q", done.message)
+	}
+	if len(done.data) != 1 || done.data[0].Name() != "elapsed" {
+		t.Fatalf("expected elapsed data, got %v", done.data)
+	}
+	if done.data[0].valueType != ValueTypeDuration {
+		t.Errorf("elapsed has value type %v", done.data[0].valueType)
+	}
+	if elapsed := done.data[0].Duration(); elapsed <= 0 {
+		t.Errorf("elapsed duration %v is not positive", elapsed)
+	}
+}
+
+// waitExited waits for a watcher goroutine to exit, returning false if it does
+// not within five seconds.
+func waitExited(exited <-chan struct{}) bool {
+	select {
+	case <-exited:
+		return true
+	case <-time.After(5 * time.Second):
+		return false
+	}
+}
+
+func TestWatchDeadline(t *testing.T) {
+	c := &recordingCodec{}
+	ctx := WithLogger(context.Background(), c)
+	done, exited := watchDeadline(ctx, 10*time.Millisecond)
+	time.Sleep(35 * time.Millisecond)
+	done()
+	done()
+	if !waitExited(exited) {
+		t.Error("watcher goroutine leaked after completion")
+	}
+	Sync()
+	c.mu.Lock()
+	n := len(c.entries)
+	c.mu.Unlock()
+	if n == 0 {
+		t.Fatal("no warning logged for slow operation")
+	}
+	e := c.entries[0]
+	if e.message != "operation still running" || e.data[0].Duration() < 10*time.Millisecond {
+		t.Errorf("unexpected warning %q %v", e.message, e.data)
+	}
+
+	// Fast operations are not logged.
+	c.entries = nil
+	done, exited = watchDeadline(ctx, 100*time.Millisecond)
+	done()
+	if !waitExited(exited) {
+		t.Error("watcher goroutine leaked after completion")
+	}
+	Sync()
+	if len(c.entries) != 0 {
+		t.Errorf("warning logged for fast operation: %v", c.entries)
+	}
+
+	// Watching stops when the context is cancelled.
+	cctx, cancel := context.WithCancel(ctx)
+	_, exited = watchDeadline(cctx, 10*time.Millisecond)
+	cancel()
+	if !waitExited(exited) {
+		t.Error("watcher goroutine leaked after cancellation")
+	}
+
+	// Non-positive thresholds watch nothing.
+	for _, threshold := range []time.Duration{0, -time.Second} {
+		done, exited = watchDeadline(ctx, threshold)
+		done()
+		if !waitExited(exited) {
+			t.Errorf("watcher started for threshold %v", threshold)
+		}
+	}
+}
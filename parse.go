@@ -0,0 +1,73 @@
+// Copyright (c) 2017 Josh Rickmar
+// Use of this source code is governed by an ISC
+// license that can be found in the LICENSE file.
+
+package mill
+
+import (
+	"context"
+	"strconv"
+	"strings"
+)
+
+// LogParsed logs a message containing embedded key=value pairs, as commonly
+// found in printf-style logs, as a structured log entry.  Each whitespace
+// separated key=value token is removed from the message and logged as a String
+// data field, while all other tokens are kept as the message text, joined by
+// single spaces.  Values containing whitespace may be double quoted using Go
+// string literal syntax (e.g. user="Jane Doe").
+//
+// This is intended as a bridge for migrating legacy log calls and is not as
+// efficient as passing structured data to Log directly.
+func LogParsed(ctx context.Context, message string) {
+	text, data := parseKV(message)
+	Log(ctx, text, data...)
+}
+
+func parseKV(s string) (string, []Data) {
+	var text []string
+	var data []Data
+	for {
+		s = strings.TrimLeft(s, " \t\r\n")
+		if s == "" {
+			break
+		}
+		var tok string
+		tok, s = nextToken(s)
+		eq := strings.IndexByte(tok, '=')
+		if eq <= 0 || strings.ContainsAny(tok[:eq], `"`) {
+			text = append(text, tok)
+			continue
+		}
+		key, value := tok[:eq], tok[eq+1:]
+		if strings.HasPrefix(value, `"`) {
+			v, err := strconv.Unquote(value)
+			if err != nil {
+				text = append(text, tok)
+				continue
+			}
+			value = v
+		}
+		data = append(data, String(key, value))
+	}
+	return strings.Join(text, " "), data
+}
+
+// nextToken splits s at the first whitespace character that is not contained
+// in a double quoted string.
+func nextToken(s string) (tok, rest string) {
+	quoted, escaped := false, false
+	for i := 0; i < len(s); i++ {
+		switch c := s[i]; {
+		case escaped:
+			escaped = false
+		case quoted && c == '\\':
+			escaped = true
+		case c == '"':
+			quoted = !quoted
+		case !quoted && (c == ' ' || c == '\t' || c == '\r' || c == '\n'):
+			return s[:i], s[i:]
+		}
+	}
+	return s, ""
+}
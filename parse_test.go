@@ -0,0 +1,59 @@
+// Copyright (c) 2017 Josh Rickmar
+// Use of this source code is governed by an ISC
+// license that can be found in the LICENSE file.
+
+package mill
+
+import (
+	"context"
+	"testing"
+)
+
+func TestParseKV(t *testing.T) {
+	tests := []struct {
+		in   string
+		text string
+		data []KV
+	}{
+		{"just a message", "just a message", nil},
+		{"connected peer=1.2.3.4 port=8333", "connected", []KV{{"peer", "1.2.3.4"}, {"port", "8333"}}},
+		{`user="Jane Doe" logged in from host=a`, "logged in from", []KV{{"user", "Jane Doe"}, {"host", "a"}}},
+		{`quote="say \"hi\"" done`, "done", []KV{{"quote", `say "hi"`}}},
+		{"x = y =z empty=", "x = y =z", []KV{{"empty", ""}}},
+		{`bad="unterminated value`, `bad="unterminated value`, nil},
+	}
+	for _, test := range tests {
+		text, data := parseKV(test.in)
+		if text != test.text {
+			t.Errorf("%q: message %q, expected %q", test.in, text, test.text)
+		}
+		if len(data) != len(test.data) {
+			t.Errorf("%q: %d data fields, expected %d", test.in, len(data), len(test.data))
+			continue
+		}
+		for i := range data {
+			if data[i].Name() != test.data[i].Key || data[i].String() != test.data[i].Value {
+				t.Errorf("%q: data %d is %s=%s, expected %s=%s", test.in, i,
+					data[i].Name(), data[i].String(), test.data[i].Key, test.data[i].Value)
+			}
+		}
+	}
+}
+
+func TestLogParsed(t *testing.T) {
+	c := &recordingCodec{}
+	ctx := WithLogger(context.Background(), c)
+	LogParsed(ctx, `request failed status=500 path="/a b"`)
+	Sync()
+
+	if len(c.entries) != 1 {
+		t.Fatalf("expected 1 entry, got %d", len(c.entries))
+	}
+	e := c.entries[0]
+	if e.message != "request failed" || len(e.data) != 2 {
+		t.Fatalf("unexpected entry %q %v", e.message, e.data)
+	}
+	if e.data[1].Name() != "path" || e.data[1].String() != "/a b" {
+		t.Errorf("unexpected path field %s=%s", e.data[1].Name(), e.data[1].String())
+	}
+}
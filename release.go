@@ -22,3 +22,5 @@ func debuggingEnabled(ctx context.Context) bool { return false }
 func withDebuggingInitialized(ctx context.Context) context.Context { return ctx }
 
 func setGlobalDebuggingEnabled(enabled bool) {}
+
+func setComponentDebugEnabled(component string, enabled bool) {}
@@ -0,0 +1,127 @@
+// Copyright (c) 2017 Josh Rickmar
+// Use of this source code is governed by an ISC
+// license that can be found in the LICENSE file.
+
+package mill
+
+import (
+	"sort"
+	"sync"
+	"time"
+)
+
+// SamplingStrategy describes which occurrences of a log message are kept by a
+// Sampler.
+type SamplingStrategy uint
+
+// Sampling strategies.
+const (
+	// SampleEveryNth keeps only every Nth occurrence of each message.
+	SampleEveryNth SamplingStrategy = iota
+
+	// SampleFirstEveryNth always keeps the first occurrence of each message,
+	// followed by every Nth occurrence after.  When the Sampler is closed, a
+	// summary entry reporting the total number of occurrences of each sampled
+	// message is written.
+	SampleFirstEveryNth
+)
+
+// MaxSampledMessages is the maximum number of distinct messages a Sampler
+// counts separately.
+const MaxSampledMessages = 10000
+
+// Sampler is a Codec that only encodes a sample of log entries with the inner
+// codec.  Entries are sampled separately for each message, for up to
+// MaxSampledMessages distinct messages.  Occurrences of any further messages
+// are counted and sampled together.
+type Sampler struct {
+	inner    Codec
+	n        uint64
+	strategy SamplingStrategy
+	counts   map[string]uint64
+	other    uint64 // occurrences of messages beyond MaxSampledMessages
+	mu       sync.Mutex
+}
+
+// SamplingCodec creates a Sampler which encodes a sample of log entries to the
+// inner codec, keeping occurrences of each message determined by strategy and
+// the sampling period n.  A period of zero or one keeps every entry.
+func SamplingCodec(inner Codec, n uint64, strategy SamplingStrategy) *Sampler {
+	if n == 0 {
+		n = 1
+	}
+	return &Sampler{
+		inner:    inner,
+		n:        n,
+		strategy: strategy,
+		counts:   make(map[string]uint64),
+	}
+}
+
+func (s *Sampler) keep(message string) bool {
+	var count uint64
+	s.mu.Lock()
+	if c, ok := s.counts[message]; ok || len(s.counts) < MaxSampledMessages {
+		count = c + 1
+		s.counts[message] = count
+	} else {
+		s.other++
+		count = s.other
+	}
+	s.mu.Unlock()
+
+	switch s.strategy {
+	case SampleFirstEveryNth:
+		return count == 1 || count%s.n == 0
+	default:
+		return count%s.n == 0
+	}
+}
+
+// EncodeLogEntry implements the Codec interface.
+func (s *Sampler) EncodeLogEntry(t time.Time, tags []KV, message string, data []Data, encodeDone func(), writeReady <-chan struct{}) {
+	if s.keep(message) {
+		s.inner.EncodeLogEntry(t, tags, message, data, encodeDone, writeReady)
+		return
+	}
+
+	dropEntry(encodeDone, writeReady)
+}
+
+// Close waits for all previous log entries to be written (see Sync) and, when
+// using the SampleFirstEveryNth strategy, writes a summary entry for each
+// sampled message reporting its total number of occurrences.  Summaries are
+// written in order of the message, followed by a summary of the total
+// occurrences of all messages which were not counted separately, if any.
+// Summaries are ordered with the writes of all other log entries, and have
+// been written when Close returns.
+//
+// Close should only be called once no further entries are being logged using
+// the sampler.
+func (s *Sampler) Close() {
+	Sync()
+	if s.strategy != SampleFirstEveryNth {
+		return
+	}
+
+	s.mu.Lock()
+	messages := make([]string, 0, len(s.counts))
+	for m := range s.counts {
+		messages = append(messages, m)
+	}
+	counts, other := s.counts, s.other
+	s.counts, s.other = make(map[string]uint64), 0
+	s.mu.Unlock()
+	sort.Strings(messages)
+
+	loggers := []Codec{s.inner}
+	for _, m := range messages {
+		data := []Data{String("sampled_message", m), Uint64("total", counts[m])}
+		logEntry(loggers, FormatText, time.Time{}, nil, "sampled log entry summary", data)
+	}
+	if other != 0 {
+		data := []Data{Uint64("other_messages_total", other)}
+		logEntry(loggers, FormatText, time.Time{}, nil, "sampled log entry summary", data)
+	}
+	waitWrites()
+}
@@ -0,0 +1,114 @@
+// Copyright (c) 2017 Josh Rickmar
+// Use of this source code is governed by an ISC
+// license that can be found in the LICENSE file.
+
+package mill
+
+import (
+	"bytes"
+	"context"
+	"strconv"
+	"sync/atomic"
+	"testing"
+)
+
+func TestSamplerEveryNth(t *testing.T) {
+	c := &recordingCodec{}
+	s := SamplingCodec(c, 3, SampleEveryNth)
+	ctx := WithLogger(context.Background(), s)
+	for i := 0; i < 9; i++ {
+		Log(ctx, "message", Int64("i", int64(i)))
+	}
+	s.Close()
+
+	if len(c.entries) != 3 {
+		t.Fatalf("expected 3 entries, got %d", len(c.entries))
+	}
+	for i, e := range c.entries {
+		if got, want := e.data[0].Int64(), int64(3*i+2); got != want {
+			t.Errorf("entry %d: sampled occurrence %d, expected %d", i, got, want)
+		}
+	}
+}
+
+func TestSamplerKeepsFirstAndCounts(t *testing.T) {
+	c := &recordingCodec{}
+	s := SamplingCodec(c, 4, SampleFirstEveryNth)
+	ctx := WithLogger(context.Background(), s)
+	for i := 0; i < 10; i++ {
+		Log(ctx, "error", Int64("i", int64(i)))
+	}
+	Log(ctx, "other")
+	s.Close()
+
+	var kept []int64
+	var summaries []recordedEntry
+	for _, e := range c.entries {
+		switch e.message {
+		case "error":
+			kept = append(kept, e.data[0].Int64())
+		case "sampled log entry summary":
+			summaries = append(summaries, e)
+		}
+	}
+	if len(kept) != 3 || kept[0] != 0 || kept[1] != 3 || kept[2] != 7 {
+		t.Errorf("unexpected kept occurrences %v", kept)
+	}
+	if len(summaries) != 2 {
+		t.Fatalf("expected 2 summaries, got %d", len(summaries))
+	}
+	sum := summaries[0]
+	if sum.data[0].String() != "error" || sum.data[1].Uint64() != 10 {
+		t.Errorf("unexpected summary %v=%v", sum.data[0].String(), sum.data[1].Uint64())
+	}
+	sum = summaries[1]
+	if sum.data[0].String() != "other" || sum.data[1].Uint64() != 1 {
+		t.Errorf("unexpected summary %v=%v", sum.data[0].String(), sum.data[1].Uint64())
+	}
+}
+
+func TestSamplerSkipsLazyEvaluation(t *testing.T) {
+	var calls int32
+	expensive := Lazy("state", func() interface{} {
+		atomic.AddInt32(&calls, 1)
+		return "dump"
+	})
+
+	buf := &bytes.Buffer{}
+	ctx := WithLogger(context.Background(), SamplingCodec(TextCodec(buf), 5, SampleEveryNth))
+	for i := 0; i < 10; i++ {
+		Log(ctx, "message", expensive)
+	}
+	Sync()
+
+	if n := atomic.LoadInt32(&calls); n != 2 {
+		t.Errorf("lazy value evaluated %d times, expected 2", n)
+	}
+	lines := bytes.Split(buf.Bytes(), []byte("\n"))
+	if len(lines) != 3 || !bytes.HasSuffix(lines[0], []byte("message, state=dump")) {
+		t.Errorf("unexpected output %q", buf.Bytes())
+	}
+}
+
+func TestSamplerBoundsMessages(t *testing.T) {
+	c := &recordingCodec{}
+	s := SamplingCodec(c, 2, SampleFirstEveryNth)
+	for i := 0; i < MaxSampledMessages+10; i++ {
+		s.keep(strconv.Itoa(i))
+	}
+	s.mu.Lock()
+	tracked, other := len(s.counts), s.other
+	s.mu.Unlock()
+	if tracked != MaxSampledMessages || other != 10 {
+		t.Fatalf("tracked %d messages and %d other occurrences", tracked, other)
+	}
+
+	s.Close()
+	if len(c.entries) != MaxSampledMessages+1 {
+		t.Fatalf("unexpected number of summaries %d", len(c.entries))
+	}
+	sum := c.entries[MaxSampledMessages]
+	if sum.data[0].Name() != "other_messages_total" || sum.data[0].Uint64() != 10 {
+		t.Errorf("unexpected summary %v", sum.data)
+	}
+}
@@ -0,0 +1,116 @@
+// Copyright (c) 2017 Josh Rickmar
+// Use of this source code is governed by an ISC
+// license that can be found in the LICENSE file.
+
+//+build !nojson
+
+package mill
+
+import (
+	"net/http"
+	"sync"
+	"time"
+)
+
+// Broadcaster is a Codec that encodes log entries as JSON objects (using the
+// same schema as JSONCodec) and delivers them to all current subscribers.
+type Broadcaster struct {
+	subs map[chan []byte]struct{}
+	mu   sync.Mutex
+}
+
+// BroadcastCodec creates a Broadcaster with no subscribers.
+func BroadcastCodec() *Broadcaster {
+	return &Broadcaster{subs: make(map[chan []byte]struct{})}
+}
+
+// EncodeLogEntry implements the Codec interface.
+func (b *Broadcaster) EncodeLogEntry(t time.Time, tags []KV, message string, data []Data, encodeDone func(), writeReady <-chan struct{}) {
+	entry, err := encodeJSON(t, tags, message, data, jsonDataNested)
+	encodeDone()
+	<-writeReady
+	if err != nil {
+		return
+	}
+
+	b.mu.Lock()
+	for c := range b.subs {
+		// Entries are dropped for subscribers that are not keeping up
+		// rather than blocking all logging.
+		select {
+		case c <- entry:
+		default:
+		}
+	}
+	b.mu.Unlock()
+}
+
+// Subscribe returns a channel receiving every entry logged from now on, as a
+// JSON object without a terminating newline.  When the subscriber falls more
+// than buffer entries behind, further entries are dropped until it catches
+// up.  The returned function must be called to unsubscribe, after which the
+// channel receives no further entries.
+func (b *Broadcaster) Subscribe(buffer int) (<-chan []byte, func()) {
+	c := make(chan []byte, buffer)
+	b.mu.Lock()
+	b.subs[c] = struct{}{}
+	b.mu.Unlock()
+	var once sync.Once
+	return c, func() {
+		once.Do(func() {
+			b.mu.Lock()
+			delete(b.subs, c)
+			b.mu.Unlock()
+		})
+	}
+}
+
+func (b *Broadcaster) subscribers() int {
+	b.mu.Lock()
+	n := len(b.subs)
+	b.mu.Unlock()
+	return n
+}
+
+// sseBuffer is the number of entries buffered for each SSE client before
+// entries are dropped.
+const sseBuffer = 256
+
+// SSEHandler returns an http.Handler that streams the entries of b to each
+// client as Server-Sent Events (text/event-stream), with each entry sent as a
+// single data frame containing the JSON object.  Clients are unsubscribed when
+// they disconnect.  Entries are dropped for clients which are too slow to
+// receive them.
+func SSEHandler(b *Broadcaster) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		flusher, ok := w.(http.Flusher)
+		if !ok {
+			http.Error(w, "streaming unsupported", http.StatusInternalServerError)
+			return
+		}
+		entries, unsubscribe := b.Subscribe(sseBuffer)
+		defer unsubscribe()
+
+		h := w.Header()
+		h.Set("Content-Type", "text/event-stream")
+		h.Set("Cache-Control", "no-cache")
+		w.WriteHeader(http.StatusOK)
+		flusher.Flush()
+
+		frame := make([]byte, 0, 512)
+		for {
+			select {
+			case entry := <-entries:
+				frame = append(frame[:0], "data: "...)
+				frame = append(frame, entry...)
+				frame = append(frame, "\n\n"...)
+				if _, err := w.Write(frame); err != nil {
+					return
+				}
+				flusher.Flush()
+			case <-r.Context().Done():
+				return
+			}
+		}
+	})
+}
@@ -0,0 +1,91 @@
+// Copyright (c) 2017 Josh Rickmar
+// Use of this source code is governed by an ISC
+// license that can be found in the LICENSE file.
+
+//+build !nojson
+
+package mill
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestSSEHandler(t *testing.T) {
+	b := BroadcastCodec()
+	srv := httptest.NewServer(SSEHandler(b))
+	defer srv.Close()
+
+	reqCtx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	req, err := http.NewRequest("GET", srv.URL, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	resp, err := http.DefaultClient.Do(req.WithContext(reqCtx))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer resp.Body.Close()
+	if ct := resp.Header.Get("Content-Type"); ct != "text/event-stream" {
+		t.Errorf("unexpected content type %q", ct)
+	}
+	if n := b.subscribers(); n != 1 {
+		t.Fatalf("%d subscribers, want 1", n)
+	}
+
+	ctx := WithLogger(context.Background(), b)
+	for i := 0; i < 3; i++ {
+		Log(ctx, "message", Int64("i", int64(i)))
+	}
+	Sync()
+
+	r := bufio.NewReader(resp.Body)
+	for i := 0; i < 3; i++ {
+		line, err := r.ReadString('\n')
+		if err != nil {
+			t.Fatal(err)
+		}
+		if !strings.HasPrefix(line, "data: ") {
+			t.Fatalf("unexpected frame %q", line)
+		}
+		var entry jsonSchema
+		if err := json.Unmarshal([]byte(line[len("data: "):]), &entry); err != nil {
+			t.Fatal(err)
+		}
+		if entry.Data["i"] != float64(i) {
+			t.Errorf("frame %d out of order: %v", i, entry.Data["i"])
+		}
+		if blank, err := r.ReadString('\n'); err != nil || blank != "\n" {
+			t.Fatalf("frame not terminated by blank line: %q %v", blank, err)
+		}
+	}
+
+	cancel()
+	for i := 0; b.subscribers() != 0; i++ {
+		if i == 100 {
+			t.Fatal("subscriber not removed after disconnect")
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+}
+
+func TestBroadcasterDropsForSlowSubscriber(t *testing.T) {
+	b := BroadcastCodec()
+	entries, unsubscribe := b.Subscribe(2)
+	defer unsubscribe()
+	ctx := WithLogger(context.Background(), b)
+	for i := 0; i < 5; i++ {
+		Log(ctx, "message")
+	}
+	Sync()
+	if n := len(entries); n != 2 {
+		t.Errorf("%d buffered entries, want 2", n)
+	}
+}
@@ -0,0 +1,164 @@
+// Copyright (c) 2017 Josh Rickmar
+// Use of this source code is governed by an ISC
+// license that can be found in the LICENSE file.
+
+package mill
+
+import (
+	"context"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// Stats describes the performance of the logger itself.  Totals are counted
+// either since the program started (see LoggerStats) or over an interval (see
+// Stats.Sub).
+type Stats struct {
+	// Time is the time the statistics were recorded.
+	Time time.Time
+
+	// Elapsed is the duration over which the totals were counted.
+	Elapsed time.Duration
+
+	// Encoded is the number of log entries encoded by all of their codecs,
+	// and EncodeTime is the total time Log spent waiting for them to be
+	// encoded, including any backpressure (see SetMaxPendingWrites).  The
+	// entries of a LogBatch call share the time of the call.
+	Encoded    uint64
+	EncodeTime time.Duration
+
+	// Entries is the number of log entries written by all of their codecs,
+	// and Latency is the total time between Log being called and them
+	// being written.  Latency includes time waiting for previous entries to
+	// be written.  The entries of a LogBatch call share its latency.
+	Entries uint64
+	Latency time.Duration
+
+	// PendingWrites is the number of entries that were encoded but not yet
+	// written at the time the statistics were recorded.
+	PendingWrites int
+}
+
+var loggerStats struct {
+	start        time.Time
+	encoded      uint64 // atomic
+	encodeNanos  int64  // atomic
+	entries      uint64 // atomic
+	latencyNanos int64  // atomic
+}
+
+func init() {
+	loggerStats.start = time.Now()
+}
+
+// recordEncode records the time spent encoding n entries, logged by a single
+// call starting at start.
+func recordEncode(start time.Time, n uint64) {
+	atomic.AddInt64(&loggerStats.encodeNanos, int64(time.Since(start)))
+	atomic.AddUint64(&loggerStats.encoded, n)
+}
+
+// recordWrite records n entries, logged by a single call starting at start,
+// being written by all codecs.
+func recordWrite(start time.Time, n uint64) {
+	atomic.AddInt64(&loggerStats.latencyNanos, int64(time.Since(start)))
+	atomic.AddUint64(&loggerStats.entries, n)
+}
+
+// LoggerStats returns the performance statistics of the logger since the
+// program started.
+func LoggerStats() Stats {
+	pendingWrites.mu.Lock()
+	pending := pendingWrites.count
+	pendingWrites.mu.Unlock()
+
+	now := time.Now()
+	return Stats{
+		Time:          now,
+		Elapsed:       now.Sub(loggerStats.start),
+		Encoded:       atomic.LoadUint64(&loggerStats.encoded),
+		EncodeTime:    time.Duration(atomic.LoadInt64(&loggerStats.encodeNanos)),
+		Entries:       atomic.LoadUint64(&loggerStats.entries),
+		Latency:       time.Duration(atomic.LoadInt64(&loggerStats.latencyNanos)),
+		PendingWrites: pending,
+	}
+}
+
+// Sub returns the statistics of the interval between the earlier statistics
+// prev and s.  PendingWrites is the value recorded by s.
+func (s Stats) Sub(prev Stats) Stats {
+	s.Elapsed = s.Time.Sub(prev.Time)
+	s.Encoded -= prev.Encoded
+	s.EncodeTime -= prev.EncodeTime
+	s.Entries -= prev.Entries
+	s.Latency -= prev.Latency
+	return s
+}
+
+// AverageEncodeTime returns the average time spent encoding each entry.
+func (s *Stats) AverageEncodeTime() time.Duration {
+	if s.Encoded == 0 {
+		return 0
+	}
+	return s.EncodeTime / time.Duration(s.Encoded)
+}
+
+// AverageWriteTime returns the average time between each entry being encoded
+// and written.
+func (s *Stats) AverageWriteTime() time.Duration {
+	if s.Entries == 0 {
+		return 0
+	}
+	write := s.Latency/time.Duration(s.Entries) - s.AverageEncodeTime()
+	if write < 0 {
+		write = 0
+	}
+	return write
+}
+
+// EntriesPerSecond returns the average rate at which entries were written.
+func (s *Stats) EntriesPerSecond() float64 {
+	if s.Elapsed <= 0 {
+		return 0
+	}
+	return float64(s.Entries) / s.Elapsed.Seconds()
+}
+
+// ReportLoggerStats logs the performance statistics of the logger over each
+// interval to ctx until the returned function is called or ctx is done.  The
+// reported entries include the reports themselves.  A non-positive interval
+// reports nothing, and the returned function does nothing.
+func ReportLoggerStats(ctx context.Context, interval time.Duration) func() {
+	if interval <= 0 {
+		return func() {}
+	}
+	done := make(chan struct{})
+	var once sync.Once
+	go func() {
+		ticker := time.NewTicker(interval)
+		defer ticker.Stop()
+		prev := LoggerStats()
+		for {
+			select {
+			case <-ticker.C:
+				stats := LoggerStats()
+				s := stats.Sub(prev)
+				prev = stats
+				Log(ctx, "logger stats",
+					Uint64("entries", s.Entries),
+					Float64("entries_per_second", s.EntriesPerSecond()),
+					Duration("average_encode_time", s.AverageEncodeTime()),
+					Duration("average_write_time", s.AverageWriteTime()),
+					Int64("pending_writes", int64(s.PendingWrites)))
+			case <-done:
+				return
+			case <-ctx.Done():
+				return
+			}
+		}
+	}()
+	return func() {
+		once.Do(func() { close(done) })
+	}
+}
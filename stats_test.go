@@ -0,0 +1,110 @@
+// Copyright (c) 2017 Josh Rickmar
+// Use of this source code is governed by an ISC
+// license that can be found in the LICENSE file.
+
+package mill
+
+import (
+	"context"
+	"io/ioutil"
+	"strings"
+	"testing"
+	"time"
+)
+
+type slowWriter struct {
+	delay time.Duration
+}
+
+func (w slowWriter) Write(p []byte) (int, error) {
+	time.Sleep(w.delay)
+	return len(p), nil
+}
+
+func TestLoggerStats(t *testing.T) {
+	const n = 50
+	const delay = 2 * time.Millisecond
+	ctx := WithLogger(context.Background(), TextCodec(slowWriter{delay}))
+	ctx = WithLogger(ctx, TextCodec(ioutil.Discard))
+
+	Sync()
+	prev := LoggerStats()
+	for i := 0; i < n; i++ {
+		Log(ctx, "message", Int64("i", int64(i)))
+	}
+	if LoggerStats().PendingWrites == 0 {
+		t.Error("no pending writes reported")
+	}
+	Sync()
+	s := LoggerStats().Sub(prev)
+	t.Logf("%+v", s)
+
+	if s.Encoded != n || s.Entries != n {
+		t.Errorf("recorded %d encoded and %d written entries, want %d", s.Encoded, s.Entries, n)
+	}
+	if s.PendingWrites != 0 {
+		t.Errorf("%d pending writes after sync", s.PendingWrites)
+	}
+	// Writes are serialized, so the entries can be written no faster than
+	// the slow writer allows.
+	if rate := s.EntriesPerSecond(); rate <= 0 || rate > float64(time.Second/delay) {
+		t.Errorf("unexpected rate %v entries/sec", rate)
+	}
+	if s.AverageWriteTime() < delay {
+		t.Errorf("average write time %v less than write delay", s.AverageWriteTime())
+	}
+	if s.AverageEncodeTime() >= s.AverageWriteTime() {
+		t.Errorf("average encode time %v not less than write time %v",
+			s.AverageEncodeTime(), s.AverageWriteTime())
+	}
+}
+
+func TestLoggerStatsBatch(t *testing.T) {
+	ctx := WithLogger(context.Background(), TextCodec(slowWriter{time.Millisecond}))
+	entries := make([]EntrySnapshot, 20)
+	for i := range entries {
+		entries[i].Message = "message"
+	}
+
+	Sync()
+	prev := LoggerStats()
+	start := time.Now()
+	LogBatch(ctx, entries...)
+	Sync()
+	elapsed := time.Since(start)
+	s := LoggerStats().Sub(prev)
+
+	if s.Encoded != 20 || s.Entries != 20 {
+		t.Errorf("recorded %d encoded and %d written entries, want 20", s.Encoded, s.Entries)
+	}
+	// The time of the call is recorded once for all of its entries.
+	if s.EncodeTime > elapsed || s.Latency > elapsed {
+		t.Errorf("encode time %v and latency %v exceed the %v elapsed", s.EncodeTime, s.Latency, elapsed)
+	}
+}
+
+func TestReportLoggerStats(t *testing.T) {
+	buf := &concurrentSafeBuffer{}
+	ctx := WithLogger(context.Background(), TextCodec(buf))
+	stop := ReportLoggerStats(ctx, 10*time.Millisecond)
+	time.Sleep(35 * time.Millisecond)
+	stop()
+	Sync()
+
+	buf.mu.Lock()
+	out := buf.String()
+	buf.mu.Unlock()
+	if !strings.Contains(out, "logger stats, entries=") {
+		t.Errorf("unexpected output %q", out)
+	}
+
+	// Non-positive intervals report nothing.
+	buf = &concurrentSafeBuffer{}
+	ctx = WithLogger(context.Background(), TextCodec(buf))
+	ReportLoggerStats(ctx, 0)()
+	ReportLoggerStats(ctx, -time.Second)()
+	Sync()
+	if buf.Len() != 0 {
+		t.Errorf("stats reported for non-positive interval: %q", buf.String())
+	}
+}
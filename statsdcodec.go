@@ -0,0 +1,119 @@
+// Copyright (c) 2017 Josh Rickmar
+// Use of this source code is governed by an ISC
+// license that can be found in the LICENSE file.
+
+package mill
+
+import (
+	"io"
+	"math"
+	"strconv"
+	"time"
+)
+
+type statsdCodec struct {
+	writer io.Writer
+	prefix string
+}
+
+// StatsDCodec creates a Codec that writes the numeric data of each log entry to
+// w as StatsD gauges, one line per field, in the form prefix.name:value|g.
+// Durations are written as timings in milliseconds (prefix.name:value|ms).
+// Log tags are appended to each line using the DogStatsD tag extension (e.g.
+// |#tag,key:value).  The message and all non-numeric data are ignored, and
+// entries without numeric data are not written.
+//
+// Since StatsD reads a signed gauge value as a change to the gauge, a negative
+// gauge is written as two lines, first setting the gauge to zero.  NaN and
+// infinite values are not written, and the characters ':', '|', and '@' of
+// metric names are replaced with underscores.
+//
+// An empty prefix omits the prefix and its separating dot.
+func StatsDCodec(w io.Writer, prefix string) Codec {
+	if prefix != "" {
+		prefix += "."
+	}
+	return &statsdCodec{writer: w, prefix: prefix}
+}
+
+func (c *statsdCodec) EncodeLogEntry(t time.Time, tags []KV, message string, data []Data, encodeDone func(), writeReady <-chan struct{}) {
+	var b []byte
+	debug := hasDebugTag(tags)
+	for i := range data {
+		d := &data[i]
+		if d.debugOnly && !debug {
+			continue
+		}
+		var value []byte
+		var negative bool
+		metricType := "g"
+		switch d.valueType {
+		case ValueTypeInt64, ValueTypeByteSize:
+			value = strconv.AppendInt(nil, int64(d.numBits), 10)
+			negative = int64(d.numBits) < 0
+		case ValueTypeUint64:
+			value = strconv.AppendUint(nil, d.numBits, 10)
+		case ValueTypeFloat64:
+			f := math.Float64frombits(d.numBits)
+			if math.IsNaN(f) || math.IsInf(f, 0) {
+				continue
+			}
+			if f == 0 {
+				f = 0 // not -0
+			}
+			value = strconv.AppendFloat(nil, f, 'f', -1, 64)
+			negative = f < 0
+		case ValueTypeDuration:
+			ms := float64(d.numBits) / float64(time.Millisecond)
+			value = strconv.AppendFloat(nil, ms, 'f', -1, 64)
+			metricType = "ms"
+		default:
+			continue
+		}
+		if negative {
+			// A signed gauge value is read as a change of the gauge, so
+			// it is first set to zero.
+			b = c.appendMetric(b, d.name, []byte{'0'}, metricType, tags)
+		}
+		b = c.appendMetric(b, d.name, value, metricType, tags)
+	}
+	encodeDone()
+
+	<-writeReady
+	if len(b) != 0 {
+		c.writer.Write(b)
+	}
+}
+
+// appendMetric appends a single metric line to b.  The characters ':', '|' and
+// '@', which delimit the fields of the line, are replaced in the metric name
+// with underscores.
+func (c *statsdCodec) appendMetric(b []byte, name string, value []byte, metricType string, tags []KV) []byte {
+	for _, s := range [...]string{c.prefix, name} {
+		for i := 0; i < len(s); i++ {
+			switch s[i] {
+			case ':', '|', '@':
+				b = append(b, '_')
+			default:
+				b = append(b, s[i])
+			}
+		}
+	}
+	b = append(b, ':')
+	b = append(b, value...)
+	b = append(b, '|')
+	b = append(b, metricType...)
+	for j, tag := range tags {
+		if j == 0 {
+			b = append(b, "|#"...)
+		} else {
+			b = append(b, ',')
+		}
+		b = append(b, tag.Key...)
+		if tag.Value != "" {
+			b = append(b, ':')
+			b = append(b, tag.Value...)
+		}
+	}
+	return append(b, '\n')
+}
@@ -0,0 +1,38 @@
+// Copyright (c) 2017 Josh Rickmar
+// Use of this source code is governed by an ISC
+// license that can be found in the LICENSE file.
+
+package mill
+
+import (
+	"bytes"
+	"context"
+	"math"
+	"testing"
+	"time"
+)
+
+func TestStatsDCodec(t *testing.T) {
+	buf := &bytes.Buffer{}
+	ctx := WithLogger(context.Background(), StatsDCodec(buf, "app"))
+	Log(ctx, "request",
+		Int64("queue", -3), Uint64("conns", 7), Float64("load", 0.25),
+		String("path", "/"), Duration("latency", 1500*time.Microsecond),
+		Float64("nan", math.NaN()), Float64("inf", math.Inf(-1)), Float64("a:b|c@d", -0.5))
+	Log(ctx, "no metrics", String("path", "/"))
+	Log(WithLogTagPair(WithLogTag(ctx, "web"), "region", "us"), "tagged", Int64("n", 1))
+	Sync()
+	t.Log("\n" + buf.String())
+
+	const want = "app.queue:0|g\n" +
+		"app.queue:-3|g\n" +
+		"app.conns:7|g\n" +
+		"app.load:0.25|g\n" +
+		"app.latency:1.5|ms\n" +
+		"app.a_b_c_d:0|g\n" +
+		"app.a_b_c_d:-0.5|g\n" +
+		"app.n:1|g|#web,region:us\n"
+	if buf.String() != want {
+		t.Errorf("unexpected output %q, expected %q", buf.String(), want)
+	}
+}
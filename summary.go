@@ -0,0 +1,78 @@
+// Copyright (c) 2017 Josh Rickmar
+// Use of this source code is governed by an ISC
+// license that can be found in the LICENSE file.
+
+package mill
+
+import (
+	"context"
+	"sort"
+	"sync"
+	"time"
+)
+
+// Summary accumulates durations of many timed operations so that their
+// statistics may be logged as a single entry.  Summary is safe for concurrent
+// use.  The zero value is an empty summary ready to use.
+type Summary struct {
+	durations []time.Duration
+	mu        sync.Mutex
+}
+
+type durationSlice []time.Duration
+
+func (s durationSlice) Len() int           { return len(s) }
+func (s durationSlice) Less(i, j int) bool { return s[i] < s[j] }
+func (s durationSlice) Swap(i, j int)      { s[i], s[j] = s[j], s[i] }
+
+// Add records a duration.
+func (s *Summary) Add(d time.Duration) {
+	s.mu.Lock()
+	s.durations = append(s.durations, d)
+	s.mu.Unlock()
+}
+
+// Reset removes all recorded durations.
+func (s *Summary) Reset() {
+	s.mu.Lock()
+	s.durations = nil
+	s.mu.Unlock()
+}
+
+// Data returns the count, minimum, 50th, 90th, and 99th percentiles, and
+// maximum of all recorded durations.  Percentiles are calculated using the
+// nearest-rank method.  Only the count is returned if no durations have been
+// recorded.
+func (s *Summary) Data() []Data {
+	s.mu.Lock()
+	durations := make([]time.Duration, len(s.durations))
+	copy(durations, s.durations)
+	s.mu.Unlock()
+
+	n := len(durations)
+	if n == 0 {
+		return []Data{Int64("count", 0)}
+	}
+	sort.Sort(durationSlice(durations))
+	percentile := func(p int) time.Duration {
+		rank := (p*n + 99) / 100 // ceil(p/100 * n)
+		if rank < 1 {
+			rank = 1
+		}
+		return durations[rank-1]
+	}
+	return []Data{
+		Int64("count", int64(n)),
+		Duration("min", durations[0]),
+		Duration("p50", percentile(50)),
+		Duration("p90", percentile(90)),
+		Duration("p99", percentile(99)),
+		Duration("max", durations[n-1]),
+	}
+}
+
+// Log logs the statistics of all recorded durations (see Data) with message as
+// a single log entry.
+func (s *Summary) Log(ctx context.Context, message string) {
+	Log(ctx, message, s.Data()...)
+}
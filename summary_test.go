@@ -0,0 +1,64 @@
+// Copyright (c) 2017 Josh Rickmar
+// Use of this source code is governed by an ISC
+// license that can be found in the LICENSE file.
+
+package mill
+
+import (
+	"bytes"
+	"context"
+	"sync"
+	"testing"
+	"time"
+)
+
+func TestSummary(t *testing.T) {
+	var s Summary
+	var wg sync.WaitGroup
+	wg.Add(1000)
+	for i := 1; i <= 1000; i++ {
+		i := i
+		go func() {
+			s.Add(time.Duration(i) * time.Millisecond)
+			wg.Done()
+		}()
+	}
+	wg.Wait()
+
+	want := map[string]time.Duration{
+		"min": 1 * time.Millisecond,
+		"p50": 500 * time.Millisecond,
+		"p90": 900 * time.Millisecond,
+		"p99": 990 * time.Millisecond,
+		"max": 1000 * time.Millisecond,
+	}
+	data := s.Data()
+	if len(data) != 6 || data[0].Int64() != 1000 {
+		t.Fatalf("unexpected data %v", data)
+	}
+	for _, d := range data[1:] {
+		got := d.Duration()
+		if diff := got - want[d.Name()]; diff < -10*time.Millisecond || diff > 10*time.Millisecond {
+			t.Errorf("%s = %v, expected approximately %v", d.Name(), got, want[d.Name()])
+		}
+	}
+
+	buf := &bytes.Buffer{}
+	ctx := WithLogger(context.Background(), TextCodec(buf))
+	s.Log(ctx, "latency")
+	s.Reset()
+	s.Log(ctx, "latency")
+	Sync()
+	t.Log("\n" + buf.String())
+
+	lines := bytes.Split(buf.Bytes(), []byte("\n"))
+	if len(lines) != 3 {
+		t.Fatal("expected 2 lines")
+	}
+	if !bytes.HasSuffix(lines[0], []byte("latency, count=1000, min=1ms, p50=500ms, p90=900ms, p99=990ms, max=1s")) {
+		t.Errorf("unexpected summary %q", lines[0])
+	}
+	if !bytes.HasSuffix(lines[1], []byte("latency, count=0")) {
+		t.Errorf("unexpected empty summary %q", lines[1])
+	}
+}
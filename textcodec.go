@@ -6,6 +6,7 @@ package mill
 
 import (
 	"bytes"
+	"encoding"
 	"fmt"
 	"io"
 	"math"
@@ -18,28 +19,169 @@ const TimeFormat = "2006-01-02 15:04:05.000000-0700"
 
 type textCodec struct {
 	writer io.Writer
+	opts   TextCodecOptions
 	pool   sync.Pool
 }
 
+// TextCodecOptions describes optional formatting behavior of a text codec.
+type TextCodecOptions struct {
+	// TagsWidth is the minimum width, in bytes, of the bracketed tags column.
+	// Shorter tag columns are padded with spaces so that messages of entries
+	// with differing tags line up vertically.  Timestamps are always formatted
+	// with a fixed width and do not require padding.  Since each entry is
+	// encoded independently, tag columns longer than this width are not
+	// truncated and will push the message further right.
+	//
+	// A zero width disables padding.
+	TagsWidth int
+
+	// SIByteSizes formats byte sizes (see ByteSize) using SI decimal units
+	// (kB, MB, GB, ...) rather than the default IEC binary units (KiB, MiB,
+	// GiB, ...).
+	SIByteSizes bool
+
+	// DurationUnit, if non-zero, formats durations (see Duration) as a
+	// decimal number of this unit followed by the ASCII unit symbol, e.g.
+	// 0.412ms for a unit of time.Millisecond, rather than using
+	// time.Duration's String method.  This avoids the non-ASCII symbol µs
+	// that is used for durations under a millisecond.  The unit must be one
+	// of time.Nanosecond, time.Microsecond (formatted as us),
+	// time.Millisecond, time.Second, time.Minute, or time.Hour; other units
+	// are ignored.
+	DurationUnit time.Duration
+}
+
 // TextCodec creates a Codec that writes encoded human-readable log entries to
 // w.
 //
 // The format is appropiate for both stdout/stderr logging and persistent
 // logs written to a log file.  Timestamps are formatted using RFC 3339.
 func TextCodec(w io.Writer) Codec {
+	return TextCodecWithOptions(w, TextCodecOptions{})
+}
+
+// TextCodecWithOptions creates a Codec that writes encoded human-readable log
+// entries to w using the formatting options described by opts.
+func TextCodecWithOptions(w io.Writer, opts TextCodecOptions) Codec {
 	return &textCodec{
 		writer: w,
+		opts:   opts,
 		pool: sync.Pool{
 			New: func() interface{} { return bytes.NewBuffer(make([]byte, 0, 256)) },
 		},
 	}
 }
 
+// appendByteSize appends a human-readable representation of the byte size n,
+// rounded to one decimal place, to b.  Sizes under the unit base are formatted
+// as a whole number of bytes.
+func appendByteSize(b []byte, n int64, si bool) []byte {
+	base, units := 1024.0, "KMGTPE"
+	if si {
+		base, units = 1000, "kMGTPE"
+	}
+	f := float64(n)
+	if n < 0 {
+		b = append(b, '-')
+		f = -f
+	}
+	if f < base {
+		b = strconv.AppendFloat(b, f, 'f', 0, 64)
+		return append(b, 'B')
+	}
+	i := -1
+	for f >= base && i < len(units)-1 {
+		f /= base
+		i++
+	}
+	b = strconv.AppendFloat(b, f, 'f', 1, 64)
+	b = append(b, units[i])
+	if !si {
+		b = append(b, 'i')
+	}
+	return append(b, 'B')
+}
+
+var durationUnitSymbols = map[time.Duration]string{
+	time.Nanosecond:  "ns",
+	time.Microsecond: "us",
+	time.Millisecond: "ms",
+	time.Second:      "s",
+	time.Minute:      "m",
+	time.Hour:        "h",
+}
+
+// appendDuration appends the text representation of d to b, using a fixed unit
+// if one is valid.
+func appendDuration(b []byte, d, unit time.Duration) []byte {
+	symbol, ok := durationUnitSymbols[unit]
+	if !ok {
+		return append(b, d.String()...)
+	}
+	b = strconv.AppendFloat(b, float64(d)/float64(unit), 'f', -1, 64)
+	return append(b, symbol...)
+}
+
+// writeAny writes the text representation of an Any value to buf.  Values
+// implementing encoding.TextMarshaler are preferred, followed by fmt.Stringer,
+// and finally the default %v formatting.  Empty collections are written as null
+// if SetNullEmptyCollections is enabled.
+func writeAny(buf *bytes.Buffer, v interface{}) {
+	if _, null := emptyCollection(v); null {
+		buf.WriteString("null")
+		return
+	}
+	if m, ok := v.(encoding.TextMarshaler); ok {
+		b, err := m.MarshalText()
+		if err == nil {
+			buf.Write(b)
+			return
+		}
+	}
+	if s, ok := v.(fmt.Stringer); ok {
+		buf.WriteString(s.String())
+		return
+	}
+	fmt.Fprintf(buf, "%v", v)
+}
+
+// writeTextValue writes the human-readable text representation of the value of
+// d to buf.
+func writeTextValue(buf *bytes.Buffer, d *Data, opts *TextCodecOptions) {
+	switch d.Type() {
+	case ValueTypeString:
+		buf.WriteString(d.string)
+	case ValueTypeInt64:
+		b := strconv.AppendInt(buf.Bytes(), int64(d.numBits), 10)
+		*buf = *bytes.NewBuffer(b)
+		buf.WriteString(d.string)
+	case ValueTypeUint64:
+		b := strconv.AppendUint(buf.Bytes(), d.numBits, 10)
+		*buf = *bytes.NewBuffer(b)
+	case ValueTypeFloat64:
+		b := strconv.AppendFloat(buf.Bytes(), math.Float64frombits(d.numBits), 'g', -1, 64)
+		*buf = *bytes.NewBuffer(b)
+		buf.WriteString(d.string)
+	case ValueTypeAny:
+		writeAny(buf, d.anyValue())
+	case ValueTypeDuration:
+		b := appendDuration(buf.Bytes(), time.Duration(d.numBits), opts.DurationUnit)
+		*buf = *bytes.NewBuffer(b)
+	case ValueTypeByteSize:
+		b := appendByteSize(buf.Bytes(), int64(d.numBits), opts.SIByteSizes)
+		*buf = *bytes.NewBuffer(b)
+	case ValueTypeNull:
+		buf.WriteString("null")
+	}
+}
+
 func (c *textCodec) EncodeLogEntry(t time.Time, tags []KV, message string, data []Data, encodeDone func(), writeReady <-chan struct{}) {
 	buf := c.pool.Get().(*bytes.Buffer)
 
 	buf.WriteString(t.Format(TimeFormat))
-	buf.WriteString(" [")
+	buf.WriteByte(' ')
+	tagsStart := buf.Len()
+	buf.WriteByte('[')
 	for i, tag := range tags {
 		buf.WriteString(tag.Key)
 		if tag.Value != "" {
@@ -50,33 +192,27 @@ func (c *textCodec) EncodeLogEntry(t time.Time, tags []KV, message string, data
 			buf.WriteString(", ")
 		}
 	}
-	buf.WriteString("] ")
+	buf.WriteByte(']')
+	for n := buf.Len() - tagsStart; n < c.opts.TagsWidth; n++ {
+		buf.WriteByte(' ')
+	}
+	buf.WriteByte(' ')
 	buf.WriteString(message)
 
+	debug := hasDebugTag(tags)
 	for _, d := range data {
 		ty := d.Type()
 		if ty == ValueTypeUnknown || ty > valueTypeMaxValue {
 			continue
 		}
+		if d.textOmit || (d.debugOnly && !debug) {
+			continue
+		}
 
 		buf.WriteString(", ")
 		buf.WriteString(d.name)
 		buf.WriteByte('=')
-		switch d.Type() {
-		case ValueTypeString:
-			buf.WriteString(d.string)
-		case ValueTypeInt64:
-			b := strconv.AppendInt(buf.Bytes(), int64(d.numBits), 10)
-			*buf = *bytes.NewBuffer(b)
-		case ValueTypeUint64:
-			b := strconv.AppendUint(buf.Bytes(), d.numBits, 10)
-			*buf = *bytes.NewBuffer(b)
-		case ValueTypeFloat64:
-			b := strconv.AppendFloat(buf.Bytes(), math.Float64frombits(d.numBits), 'g', -1, 64)
-			*buf = *bytes.NewBuffer(b)
-		case ValueTypeAny:
-			fmt.Fprintf(buf, "%v", d.any)
-		}
+		writeTextValue(buf, &d, &c.opts)
 	}
 
 	buf.WriteByte('\n')
@@ -87,3 +223,11 @@ func (c *textCodec) EncodeLogEntry(t time.Time, tags []KV, message string, data
 	buf.Reset()
 	c.pool.Put(buf)
 }
+
+// Flush flushes the underlying writer if it implements Flusher.
+func (c *textCodec) Flush() error {
+	if f, ok := c.writer.(Flusher); ok {
+		return f.Flush()
+	}
+	return nil
+}
@@ -0,0 +1,143 @@
+// Copyright (c) 2017 Josh Rickmar
+// Use of this source code is governed by an ISC
+// license that can be found in the LICENSE file.
+
+package mill
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"testing"
+	"time"
+)
+
+func TestTextCodecAlignsColumns(t *testing.T) {
+	buf := &bytes.Buffer{}
+	ctx := WithLogger(context.Background(), TextCodecWithOptions(buf, TextCodecOptions{TagsWidth: 24}))
+	Log(ctx, "message 1")
+	Log(WithLogTag(ctx, "debug"), "message 2", String("k", "v"))
+	Log(WithLogTagPair(WithLogTag(ctx, "a"), "key", "value"), "message 3")
+	Sync()
+	t.Log("\n" + buf.String())
+
+	lines := bytes.Split(buf.Bytes(), []byte("\n"))
+	if len(lines) != 4 || len(lines[3]) != 0 {
+		t.Fatal("expected 3 lines")
+	}
+	col := -1
+	for _, line := range lines[:3] {
+		i := bytes.Index(line, []byte("message"))
+		if i == -1 {
+			t.Fatalf("no message in line %q", line)
+		}
+		if col == -1 {
+			col = i
+		} else if i != col {
+			t.Errorf("message begins at column %d, expected %d", i, col)
+		}
+	}
+}
+
+func TestTextCodecLongTagsNotTruncated(t *testing.T) {
+	buf := &bytes.Buffer{}
+	ctx := WithLogger(context.Background(), TextCodecWithOptions(buf, TextCodecOptions{TagsWidth: 4}))
+	Log(WithLogTag(ctx, "longer tag"), "message")
+	Sync()
+
+	if !bytes.Contains(buf.Bytes(), []byte(" [longer tag] message\n")) {
+		t.Errorf("unexpected output %q", buf.Bytes())
+	}
+}
+
+type textMarshaler struct{ s string }
+
+func (m textMarshaler) MarshalText() ([]byte, error) { return []byte("text:" + m.s), nil }
+func (m textMarshaler) String() string               { return "stringer:" + m.s }
+
+type failingTextMarshaler struct{ textMarshaler }
+
+func (m failingTextMarshaler) MarshalText() ([]byte, error) { return nil, errors.New("failed") }
+
+func TestTextCodecPrefersTextMarshaler(t *testing.T) {
+	buf := &bytes.Buffer{}
+	ctx := WithLogger(context.Background(), TextCodec(buf))
+	Log(ctx, "message", Any("m", textMarshaler{"value"}), Any("s", &intStringer{7}), Any("v", []int{1, 2}),
+		Any("f", failingTextMarshaler{textMarshaler{"value"}}))
+	Sync()
+	t.Log("\n" + buf.String())
+
+	if !bytes.HasSuffix(buf.Bytes(), []byte("message, m=text:value, s=7, v=[1 2], f=stringer:value\n")) {
+		t.Errorf("unexpected output %q", buf.Bytes())
+	}
+}
+
+func TestAppendByteSize(t *testing.T) {
+	tests := []struct {
+		n       int64
+		iec, si string
+	}{
+		{0, "0B", "0B"},
+		{512, "512B", "512B"},
+		{1000, "1000B", "1.0kB"},
+		{1536, "1.5KiB", "1.5kB"},
+		{1 << 20, "1.0MiB", "1.0MB"},
+		{1 << 30, "1.0GiB", "1.1GB"},
+		{5 * 1000 * 1000 * 1000 * 1000, "4.5TiB", "5.0TB"},
+		{-2048, "-2.0KiB", "-2.0kB"},
+		{1<<63 - 1, "8.0EiB", "9.2EB"},
+	}
+	for _, test := range tests {
+		if got := string(appendByteSize(nil, test.n, false)); got != test.iec {
+			t.Errorf("%d: IEC size %q, expected %q", test.n, got, test.iec)
+		}
+		if got := string(appendByteSize(nil, test.n, true)); got != test.si {
+			t.Errorf("%d: SI size %q, expected %q", test.n, got, test.si)
+		}
+	}
+}
+
+func TestTextCodecByteSize(t *testing.T) {
+	iec, si := &bytes.Buffer{}, &bytes.Buffer{}
+	ctx := WithLogger(context.Background(), TextCodec(iec))
+	ctx = WithLogger(ctx, TextCodecWithOptions(si, TextCodecOptions{SIByteSizes: true}))
+	Log(ctx, "message", ByteSize("size", 1073741824))
+	Sync()
+
+	if !bytes.HasSuffix(iec.Bytes(), []byte("message, size=1.0GiB\n")) {
+		t.Errorf("unexpected IEC output %q", iec.Bytes())
+	}
+	if !bytes.HasSuffix(si.Bytes(), []byte("message, size=1.1GB\n")) {
+		t.Errorf("unexpected SI output %q", si.Bytes())
+	}
+}
+
+func TestTextCodecDurationUnit(t *testing.T) {
+	tests := []struct {
+		unit time.Duration
+		want string
+	}{
+		{0, "message, us=412µs, ns=7ns, s=1.5s\n"},
+		{time.Millisecond, "message, us=0.412ms, ns=0.000007ms, s=1500ms\n"},
+		{time.Microsecond, "message, us=412us, ns=0.007us, s=1500000us\n"},
+		{3 * time.Millisecond, "message, us=412µs, ns=7ns, s=1.5s\n"},
+	}
+	for _, test := range tests {
+		buf := &bytes.Buffer{}
+		ctx := WithLogger(context.Background(), TextCodecWithOptions(buf, TextCodecOptions{DurationUnit: test.unit}))
+		Log(ctx, "message", Duration("us", 412*time.Microsecond), Duration("ns", 7), Duration("s", 1500*time.Millisecond))
+		Sync()
+
+		if !bytes.HasSuffix(buf.Bytes(), []byte(test.want)) {
+			t.Errorf("unit %v: unexpected output %q", test.unit, buf.Bytes())
+		}
+		if test.unit == time.Millisecond || test.unit == time.Microsecond {
+			for _, c := range buf.Bytes() {
+				if c >= 0x80 {
+					t.Errorf("unit %v: non-ASCII output %q", test.unit, buf.Bytes())
+					break
+				}
+			}
+		}
+	}
+}
@@ -0,0 +1,115 @@
+// Copyright (c) 2017 Josh Rickmar
+// Use of this source code is governed by an ISC
+// license that can be found in the LICENSE file.
+
+package mill
+
+import (
+	"context"
+	"sync"
+	"time"
+)
+
+type txEntry struct {
+	loggers []Codec
+	earlyEntry
+}
+
+// LogTx buffers the log entries of a context created by WithBuffer until they
+// are either committed or discarded.
+type LogTx struct {
+	parent  *LogTx
+	entries []txEntry
+	done    bool
+	mu      sync.Mutex
+}
+
+type txKey struct{}
+
+// WithBuffer creates a copy of the context in which all calls to Log, Debug,
+// and Event are buffered by the returned LogTx rather than being written.  The
+// entries are written by calling Commit, in order and with the timestamps of
+// when they were logged, or dropped by calling Discard.  This is useful for
+// speculative operations whose logs should not appear if the operation is
+// rolled back.
+//
+// Entries are buffered together with the loggers of the context they were
+// logged with.  Entries logged using a context without loggers are not
+// buffered.  Buffers may be nested, in which case the entries of an inner
+// buffer are committed to the outer buffer.  Once committed or discarded,
+// entries logged using the context are written immediately.
+func WithBuffer(ctx context.Context) (context.Context, *LogTx) {
+	tx := new(LogTx)
+	if parent, ok := ctx.Value(txKey{}).(*LogTx); ok {
+		tx.parent = parent
+	}
+	return context.WithValue(ctx, txKey{}, tx), tx
+}
+
+// add buffers entries, returning false if the transaction has finished and
+// the entries must be logged by the parent transaction (if any) instead.
+func (tx *LogTx) add(entries ...txEntry) bool {
+	tx.mu.Lock()
+	defer tx.mu.Unlock()
+	if tx.done {
+		return false
+	}
+	tx.entries = append(tx.entries, entries...)
+	return true
+}
+
+// bufferTxEntry buffers an entry in the innermost unfinished transaction of the
+// context, returning whether it was buffered.  If t is the zero time, the entry
+// is timestamped with the current time.
+func bufferTxEntry(ctx context.Context, loggers []Codec, format Format, t time.Time, tags []KV, message string, data []Data) bool {
+	tx, _ := ctx.Value(txKey{}).(*LogTx)
+	if tx == nil {
+		return false
+	}
+	if t.IsZero() {
+		t = time.Now()
+	}
+	e := txEntry{loggers, earlyEntry{
+		format:  format,
+		t:       t,
+		tags:    tags,
+		message: message,
+		data:    CopyData(data),
+	}}
+	for ; tx != nil; tx = tx.parent {
+		if tx.add(e) {
+			return true
+		}
+	}
+	return false
+}
+
+// Commit writes all buffered entries, in the order they were logged, and
+// finishes the transaction.  If the buffer is nested in an unfinished buffer,
+// the entries are moved to that buffer instead.
+func (tx *LogTx) Commit() {
+	// The transaction remains locked until all entries are committed, so
+	// that entries logged after the commit are not written first.
+	tx.mu.Lock()
+	defer tx.mu.Unlock()
+	entries := tx.entries
+	tx.entries = nil
+	tx.done = true
+	for p := tx.parent; p != nil; p = p.parent {
+		if p.add(entries...) {
+			return
+		}
+	}
+	for i := range entries {
+		e := &entries[i]
+		logEntry(e.loggers, e.format, e.t, e.tags, e.message, e.data)
+	}
+}
+
+// Discard drops all buffered entries and finishes the transaction.
+func (tx *LogTx) Discard() {
+	tx.mu.Lock()
+	tx.entries = nil
+	tx.done = true
+	tx.mu.Unlock()
+}
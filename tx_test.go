@@ -0,0 +1,88 @@
+// Copyright (c) 2017 Josh Rickmar
+// Use of this source code is governed by an ISC
+// license that can be found in the LICENSE file.
+
+package mill
+
+import (
+	"context"
+	"testing"
+	"time"
+)
+
+func TestLogTxCommit(t *testing.T) {
+	c := &recordingCodec{}
+	ctx := WithLogger(context.Background(), c)
+	txCtx, tx := WithBuffer(ctx)
+	before := time.Now()
+	Log(txCtx, "buffered 1", Int64("i", 1))
+	Log(txCtx, "buffered 2")
+	Log(ctx, "unbuffered")
+	Sync()
+	if len(c.entries) != 1 || c.entries[0].message != "unbuffered" {
+		t.Fatalf("unexpected entries before commit %v", c.entries)
+	}
+
+	tx.Commit()
+	Log(txCtx, "after commit")
+	Sync()
+	want := []string{"unbuffered", "buffered 1", "buffered 2", "after commit"}
+	if len(c.entries) != len(want) {
+		t.Fatalf("unexpected entries %v", c.entries)
+	}
+	for i, e := range c.entries {
+		if e.message != want[i] {
+			t.Errorf("entry %d: message %q, want %q", i, e.message, want[i])
+		}
+	}
+	if e := c.entries[1]; e.t.Before(before) || !e.t.Before(c.entries[0].t) || e.data[0].Int64() != 1 {
+		t.Errorf("buffered entry has unexpected timestamp or data: %v", e)
+	}
+}
+
+func TestLogTxDiscard(t *testing.T) {
+	c := &recordingCodec{}
+	ctx := WithLogger(context.Background(), c)
+	txCtx, tx := WithBuffer(ctx)
+	Log(txCtx, "discarded")
+	Event(txCtx, "discarded_event")
+	tx.Discard()
+	tx.Commit()
+	Sync()
+	if len(c.entries) != 0 {
+		t.Errorf("discarded entries were written: %v", c.entries)
+	}
+}
+
+func TestLogTxNested(t *testing.T) {
+	c := &recordingCodec{}
+	ctx := WithLogger(context.Background(), c)
+	outerCtx, outer := WithBuffer(ctx)
+	innerCtx, inner := WithBuffer(outerCtx)
+	Log(innerCtx, "inner")
+	inner.Commit()
+	Log(innerCtx, "inner after commit")
+	Sync()
+	if len(c.entries) != 0 {
+		t.Fatalf("inner commit wrote entries: %v", c.entries)
+	}
+	outer.Commit()
+	Sync()
+	if len(c.entries) != 2 || c.entries[0].message != "inner" || c.entries[1].message != "inner after commit" {
+		t.Errorf("unexpected entries %v", c.entries)
+	}
+}
+
+func TestLogTxResolvesLazy(t *testing.T) {
+	c := &recordingCodec{}
+	ctx, tx := WithBuffer(WithLogger(context.Background(), c))
+	state := "logged"
+	Log(ctx, "message", Lazy("state", func() interface{} { return state }))
+	state = "committed"
+	tx.Commit()
+	Sync()
+
+	if len(c.entries) != 1 || c.entries[0].data[0].Value() != "logged" {
+		t.Errorf("unexpected entries %v", c.entries)
+	}
+}
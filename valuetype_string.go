@@ -4,9 +4,9 @@ package mill
 
 import "fmt"
 
-const _ValueType_name = "ValueTypeUnknownValueTypeStringValueTypeInt64ValueTypeUint64ValueTypeFloat64ValueTypeAny"
+const _ValueType_name = "ValueTypeUnknownValueTypeStringValueTypeInt64ValueTypeUint64ValueTypeFloat64ValueTypeAnyValueTypeDurationValueTypeByteSizeValueTypeNull"
 
-var _ValueType_index = [...]uint8{0, 16, 31, 45, 60, 76, 88}
+var _ValueType_index = [...]uint8{0, 16, 31, 45, 60, 76, 88, 105, 122, 135}
 
 func (i ValueType) String() string {
 	if i >= ValueType(len(_ValueType_index)-1) {
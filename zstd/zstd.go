@@ -0,0 +1,113 @@
+// Copyright (c) 2017 Josh Rickmar
+// Use of this source code is governed by an ISC
+// license that can be found in the LICENSE file.
+
+// Package zstd implements a writer which compresses log output with
+// Zstandard, using the encoder of github.com/klauspost/compress/zstd.
+//
+// Zstandard compresses log output at ratios similar to gzip with much higher
+// throughput, making it a better fit for high-volume archival of logs.
+package zstd
+
+import (
+	"errors"
+	"io"
+	"sync"
+
+	"github.com/jrick/mill"
+	kzstd "github.com/klauspost/compress/zstd"
+)
+
+// ErrClosed is returned by writes to a closed writer.
+var ErrClosed = errors.New("zstd: writer is closed")
+
+// DefaultLevel is the compression level used by NewWriter for levels less than
+// one.  It is the fastest level, which compresses log output at ratios similar
+// to the default level of gzip (see the benchmarks of this package).
+const DefaultLevel = 1
+
+type writer struct {
+	writer io.Writer
+	enc    *kzstd.Encoder
+	err    error
+	closed bool
+	mu     sync.Mutex
+}
+
+// NewWriter creates a writer which compresses all writes to w as a single
+// Zstandard frame.  Level is a Zstandard compression level, from 1 (fastest)
+// to 22, which is mapped to the nearest level supported by the encoder.
+// Levels less than one select DefaultLevel.
+//
+// Writes are serialized, so the writer may be shared between codecs writing
+// concurrently.  The writer is flushed by mill.Sync, and implements
+// mill.Flusher for mill.FlushCodec: once either returns, all entries logged
+// before it are decompressable from the output.  Flushing also flushes w if it
+// implements mill.Flusher.
+//
+// Close waits for all entries logged before Close to be written and ends the
+// frame, but does not close w.  Writes after Close fail with ErrClosed.
+func NewWriter(w io.Writer, level int) io.WriteCloser {
+	if level < 1 {
+		level = DefaultLevel
+	}
+	z := &writer{writer: w}
+	z.enc, z.err = kzstd.NewWriter(w,
+		kzstd.WithEncoderLevel(kzstd.EncoderLevelFromZstd(level)),
+		kzstd.WithEncoderConcurrency(1))
+	mill.FlushOnSync(z, true)
+	return z
+}
+
+// Write implements the io.Writer interface.
+func (z *writer) Write(p []byte) (n int, err error) {
+	z.mu.Lock()
+	defer z.mu.Unlock()
+	if z.closed {
+		return 0, ErrClosed
+	}
+	if z.err != nil {
+		return 0, z.err
+	}
+	n, err = z.enc.Write(p)
+	if err != nil {
+		z.err = err
+	}
+	return n, err
+}
+
+// Flush writes all data written so far as complete blocks, and then flushes
+// the underlying writer if it implements mill.Flusher.
+func (z *writer) Flush() error {
+	z.mu.Lock()
+	defer z.mu.Unlock()
+	if z.err != nil {
+		return z.err
+	}
+	if !z.closed {
+		if err := z.enc.Flush(); err != nil {
+			z.err = err
+			return err
+		}
+	}
+	if f, ok := z.writer.(mill.Flusher); ok {
+		return f.Flush()
+	}
+	return nil
+}
+
+// Close ends the frame.
+func (z *writer) Close() error {
+	mill.FlushOnSync(z, false)
+	mill.Sync()
+	z.mu.Lock()
+	defer z.mu.Unlock()
+	if z.closed {
+		return nil
+	}
+	z.closed = true
+	if z.err != nil {
+		return z.err
+	}
+	return z.enc.Close()
+}
@@ -0,0 +1,194 @@
+// Copyright (c) 2017 Josh Rickmar
+// Use of this source code is governed by an ISC
+// license that can be found in the LICENSE file.
+
+package zstd
+
+import (
+	"bytes"
+	"compress/gzip"
+	"context"
+	"io"
+	"io/ioutil"
+	"math/rand"
+	"strconv"
+	"sync"
+	"testing"
+
+	"github.com/jrick/mill"
+	kzstd "github.com/klauspost/compress/zstd"
+)
+
+type concurrentSafeBuffer struct {
+	bytes.Buffer
+	mu sync.Mutex
+}
+
+func (w *concurrentSafeBuffer) Write(p []byte) (n int, err error) {
+	w.mu.Lock()
+	n, err = w.Buffer.Write(p)
+	w.mu.Unlock()
+	return
+}
+
+func (w *concurrentSafeBuffer) bytes() []byte {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	return append([]byte(nil), w.Buffer.Bytes()...)
+}
+
+// decompress decodes as much of the frame as is available.  Frames which have
+// not been ended by Close are decoded up to the last complete block.
+func decompress(t *testing.T, frame []byte, ended bool) []byte {
+	dec, err := kzstd.NewReader(bytes.NewReader(frame))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer dec.Close()
+	out, err := ioutil.ReadAll(dec)
+	if err != nil && (ended || err != io.ErrUnexpectedEOF) {
+		t.Fatal(err)
+	}
+	return out
+}
+
+func TestWriterEntriesReadableAfterSync(t *testing.T) {
+	var buf concurrentSafeBuffer
+	zw := NewWriter(&buf, 0)
+	ctx := mill.WithLogger(context.Background(), mill.TextCodec(zw))
+	for i := 0; i < 1000; i++ {
+		mill.Log(ctx, "message", mill.Int64("i", int64(i)))
+	}
+	mill.Sync()
+
+	// No Close: all entries logged before Sync must be decodable.
+	compressed := buf.bytes()
+	lines := bytes.Split(decompress(t, compressed, false), []byte("\n"))
+	if len(lines) != 1001 || len(lines[1000]) != 0 {
+		t.Fatalf("expected 1000 lines, got %d", len(lines)-1)
+	}
+	for i, line := range lines[:1000] {
+		if want := "[] message, i=" + strconv.Itoa(i); !bytes.HasSuffix(line, []byte(want)) {
+			t.Errorf("line %d: %q, want suffix %q", i, line, want)
+		}
+	}
+	uncompressed := 0
+	for _, line := range lines {
+		uncompressed += len(line) + 1
+	}
+	if len(compressed) >= uncompressed/2 {
+		t.Errorf("poor compression: %d bytes from %d", len(compressed), uncompressed)
+	}
+
+	mill.Log(ctx, "after sync")
+	if err := zw.Close(); err != nil {
+		t.Fatal(err)
+	}
+	out := decompress(t, buf.bytes(), true)
+	if !bytes.HasSuffix(out, []byte("[] after sync\n")) {
+		t.Errorf("entry logged before close missing from closed frame")
+	}
+	if _, err := zw.Write([]byte("x")); err != ErrClosed {
+		t.Errorf("write after close: %v", err)
+	}
+}
+
+func TestWriterRoundTrip(t *testing.T) {
+	// Mix of random and repeated data, written with both small and large
+	// writes.
+	rng := rand.New(rand.NewSource(1))
+	var data []byte
+	for len(data) < 3<<20 {
+		switch rng.Intn(3) {
+		case 0:
+			chunk := make([]byte, rng.Intn(300))
+			rng.Read(chunk)
+			data = append(data, chunk...)
+		case 1:
+			if len(data) > 0 {
+				from := rng.Intn(len(data))
+				n := rng.Intn(70000)
+				if from+n > len(data) {
+					n = len(data) - from
+				}
+				data = append(data, data[from:from+n]...)
+			}
+		default:
+			data = append(data, bytes.Repeat([]byte{byte(rng.Intn(256))}, rng.Intn(100))...)
+		}
+	}
+
+	for _, level := range []int{DefaultLevel, 3, 9, 22} {
+		var buf bytes.Buffer
+		zw := NewWriter(&buf, level)
+		for p := data; len(p) != 0; {
+			n := 1 + rng.Intn(1<<18)
+			if n > len(p) {
+				n = len(p)
+			}
+			if _, err := zw.Write(p[:n]); err != nil {
+				t.Fatal(err)
+			}
+			p = p[n:]
+		}
+		if err := zw.Close(); err != nil {
+			t.Fatal(err)
+		}
+		if out := decompress(t, buf.Bytes(), true); !bytes.Equal(out, data) {
+			t.Fatalf("level %d: round trip mismatch", level)
+		}
+	}
+}
+
+// benchmarkLines is log output used to compare compressors.
+var benchmarkLines = func() [][]byte {
+	var buf concurrentSafeBuffer
+	ctx := mill.WithLogger(context.Background(), mill.TextCodec(&buf))
+	for i := 0; i < 100000; i++ {
+		mill.Log(ctx, "request", mill.String("path", "/api/items/"+strconv.Itoa(i%97)),
+			mill.Int64("status", 200), mill.Int64("i", int64(i)))
+	}
+	mill.Sync()
+	return bytes.SplitAfter(buf.bytes(), []byte("\n"))
+}()
+
+// benchmarkCompression writes log output line by line to a compressing writer,
+// reporting the throughput of uncompressed output and the compression ratio.
+func benchmarkCompression(b *testing.B, newWriter func(io.Writer) io.WriteCloser) {
+	var uncompressed int64
+	for _, line := range benchmarkLines {
+		uncompressed += int64(len(line))
+	}
+	var compressed countingWriter
+	b.SetBytes(uncompressed)
+	b.ReportAllocs()
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		compressed = 0
+		w := newWriter(&compressed)
+		for _, line := range benchmarkLines {
+			w.Write(line)
+		}
+		w.Close()
+	}
+	b.ReportMetric(float64(uncompressed)/float64(compressed), "ratio")
+}
+
+type countingWriter int64
+
+func (w *countingWriter) Write(p []byte) (int, error) {
+	*w += countingWriter(len(p))
+	return len(p), nil
+}
+
+func BenchmarkZstd(b *testing.B) {
+	benchmarkCompression(b, func(w io.Writer) io.WriteCloser { return NewWriter(w, DefaultLevel) })
+}
+
+func BenchmarkZstdLevel3(b *testing.B) {
+	benchmarkCompression(b, func(w io.Writer) io.WriteCloser { return NewWriter(w, 3) })
+}
+
+func BenchmarkGzip(b *testing.B) {
+	benchmarkCompression(b, func(w io.Writer) io.WriteCloser { return gzip.NewWriter(w) })
+}